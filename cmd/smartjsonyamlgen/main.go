@@ -0,0 +1,159 @@
+/*  smartjsonyamlgen generates typed path-accessor methods for SmartJSON/SmartYAML configs
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+// Command smartjsonyamlgen reads an example JSON document and emits a Go
+// file with one typed accessor method per scalar leaf, plus the path
+// constants it uses, so callers get compile-time-checked accessors while
+// keeping the dynamic SmartJsonYamlBase underneath.
+//
+// Usage:
+//
+//	smartjsonyamlgen -in example.json -type Config -package myconfig -out config_gen.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"smartjsonyamlstub"
+)
+
+func main() {
+	inPath := flag.String("in", "", "example JSON document to infer accessors from")
+	typeName := flag.String("type", "Config", "name of the generated accessor type")
+	pkgName := flag.String("package", "main", "package name of the generated file")
+	outPath := flag.String("out", "", "output file (defaults to stdout)")
+	importPath := flag.String("import", "github.com/hyper-prog/smartjsonyamlstub", "import path of the smartjsonyamlstub package")
+	flag.Parse()
+
+	if *inPath == "" {
+		fmt.Fprintln(os.Stderr, "smartjsonyamlgen: -in is required")
+		os.Exit(1)
+	}
+
+	data, err := os.ReadFile(*inPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "smartjsonyamlgen: %v\n", err)
+		os.Exit(1)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		fmt.Fprintf(os.Stderr, "smartjsonyamlgen: %s is not valid JSON (YAML input requires converting through smartyaml first): %v\n", *inPath, err)
+		os.Exit(1)
+	}
+
+	leaves := collectLeaves("", doc)
+	sort.Slice(leaves, func(i, j int) bool { return leaves[i].path < leaves[j].path })
+
+	src := generate(*pkgName, *typeName, *importPath, leaves)
+	if formatted, err := format.Source([]byte(src)); err == nil {
+		src = string(formatted)
+	}
+
+	if *outPath == "" {
+		fmt.Print(src)
+		return
+	}
+	if err := os.WriteFile(*outPath, []byte(src), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "smartjsonyamlgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// leaf is one scalar value found while walking the example document, at
+// the module's own "/a/[0]/b" path notation.
+type leaf struct {
+	path string
+	kind string // "string", "bool", "int", "float64"
+}
+
+func collectLeaves(path string, v interface{}) []leaf {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		out := []leaf{}
+		for k, child := range n {
+			out = append(out, collectLeaves(joinGenPath(path, k), child)...)
+		}
+		return out
+	case []interface{}:
+		out := []leaf{}
+		for i, child := range n {
+			out = append(out, collectLeaves(joinGenPath(path, "["+strconv.Itoa(i)+"]"), child)...)
+		}
+		return out
+	case string:
+		return []leaf{{path: path, kind: "string"}}
+	case bool:
+		return []leaf{{path: path, kind: "bool"}}
+	case float64:
+		if n == float64(int64(n)) {
+			return []leaf{{path: path, kind: "int"}}
+		}
+		return []leaf{{path: path, kind: "float64"}}
+	}
+	return nil
+}
+
+func joinGenPath(base string, seg string) string {
+	if base == "" {
+		return seg
+	}
+	if strings.HasPrefix(seg, "[") {
+		return base + "/" + seg
+	}
+	return base + "/" + seg
+}
+
+func generate(pkgName string, typeName string, importPath string, leaves []leaf) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by smartjsonyamlgen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkgName)
+	fmt.Fprintf(&b, "import sjy \"%s\"\n\n", importPath)
+
+	fmt.Fprintf(&b, "// %s wraps a sjy.SmartJsonYamlBase with compile-time-checked accessors\n", typeName)
+	fmt.Fprintf(&b, "type %s struct {\n\tbase sjy.SmartJsonYamlBase\n}\n\n", typeName)
+
+	fmt.Fprintf(&b, "// New%s wraps base with typed accessors\n", typeName)
+	fmt.Fprintf(&b, "func New%s(base sjy.SmartJsonYamlBase) *%s {\n\treturn &%s{base: base}\n}\n\n", typeName, typeName, typeName)
+
+	if len(leaves) > 0 {
+		b.WriteString("const (\n")
+		for _, l := range leaves {
+			fmt.Fprintf(&b, "\t%sPath%s = %q\n", typeName, smartjsonyamlstub.PathConstName(l.path), l.path)
+		}
+		b.WriteString(")\n\n")
+	}
+
+	for _, l := range leaves {
+		method := smartjsonyamlstub.PathConstName(l.path)
+		constName := fmt.Sprintf("%sPath%s", typeName, method)
+		goType, getter, zero := accessorFor(l.kind)
+		fmt.Fprintf(&b, "// %s returns the value at %q\n", method, l.path)
+		fmt.Fprintf(&b, "func (c *%s) %s() %s {\n\treturn c.base.%s(%s, %s)\n}\n\n", typeName, method, goType, getter, constName, zero)
+	}
+
+	return b.String()
+}
+
+func accessorFor(kind string) (goType string, getter string, zero string) {
+	switch kind {
+	case "string":
+		return "string", "GetStringByPathWithDefault", `""`
+	case "bool":
+		return "bool", "GetBoolByPathWithDefault", "false"
+	case "int":
+		return "int", "GetIntegerByPathWithDefault", "0"
+	case "float64":
+		return "float64", "GetFloat64ByPathWithDefault", "0"
+	}
+	return "interface{}", "GetStringByPathWithDefault", `""`
+}
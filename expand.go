@@ -0,0 +1,230 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ExpandOptions gates the features of ExpandReferences so security-conscious
+// users can opt into only what they need.
+type ExpandOptions struct {
+	// EnableEnv enables expansion of ${ENV:VAR_NAME} and ${ENV:VAR_NAME:-default}
+	EnableEnv bool
+	// EnableRefs enables expansion of ${PATH:/some/other/node}, which
+	// looks up another node of the same document
+	EnableRefs bool
+	// EnableFileInclude enables expansion of ${FILE:./path.yaml#/sub/path}
+	// and the map-value level ${INCLUDE:path.yaml}
+	EnableFileInclude bool
+	// BaseDir is the directory relative file references are resolved against
+	BaseDir string
+	// MaxDepth bounds how many levels of FILE/INCLUDE nesting are followed
+	// before ExpandReferences gives up with an error (cycle protection).
+	// A value of zero means the default of 32 is used.
+	MaxDepth int
+	// Parse is used to parse the content of an included file into a
+	// SmartJsonYamlBase. It must be supplied by the caller (the smartjson
+	// and smartyaml packages each know how to parse their own format); a
+	// nil Parse makes ${FILE:...} / ${INCLUDE:...} expansion fail with an
+	// UnresolvedReferenceError instead of silently leaving the token.
+	Parse func(filename string) (SmartJsonYamlBase, error)
+}
+
+// UnresolvedReferenceError is returned by ExpandReferences when one or more
+// ${...} references could not be resolved. It lists every failure instead
+// of stopping at the first one so a user can fix a config in one pass.
+type UnresolvedReferenceError struct {
+	Refs []string
+}
+
+func (e *UnresolvedReferenceError) Error() string {
+	return fmt.Sprintf("smartjsonyamlstub: %d unresolved reference(s): %s", len(e.Refs), strings.Join(e.Refs, ", "))
+}
+
+const defaultExpandMaxDepth = 32
+
+var envRefRe = regexp.MustCompile(`\$\{ENV:([A-Za-z_][A-Za-z0-9_]*)(:-(.*?))?\}`)
+var pathRefRe = regexp.MustCompile(`\$\{PATH:([^}]+)\}`)
+var fileRefRe = regexp.MustCompile(`\$\{FILE:([^#}]+)(#([^}]*))?\}`)
+var includeRefRe = regexp.MustCompile(`^\$\{INCLUDE:([^}]+)\}$`)
+
+// ExpandReferences walks ParsedData in place and expands, inside string
+// values, ${ENV:...}, ${PATH:...} and ${FILE:...#...} references, and at
+// the map-value level, ${INCLUDE:...} references. Every feature is gated by
+// opts and off by default. Any reference left unresolved is collected and
+// reported via UnresolvedReferenceError rather than silently kept as a
+// literal "${...}" token.
+func (sjyb *SmartJsonYamlBase) ExpandReferences(opts ExpandOptions) error {
+	if opts.MaxDepth == 0 {
+		opts.MaxDepth = defaultExpandMaxDepth
+	}
+	e := &expander{sjyb: sjyb, opts: opts, visitedFiles: map[string]bool{}}
+	expanded, unresolved := e.expandNode(sjyb.ParsedData, 0)
+	sjyb.ParsedData = expanded
+	if len(unresolved) > 0 {
+		return &UnresolvedReferenceError{Refs: unresolved}
+	}
+	return nil
+}
+
+type expander struct {
+	sjyb         *SmartJsonYamlBase
+	opts         ExpandOptions
+	visitedFiles map[string]bool
+}
+
+func (e *expander) expandNode(v interface{}, depth int) (interface{}, []string) {
+	unresolved := []string{}
+
+	if m, isMap := v.(map[string]interface{}); isMap {
+		out := map[string]interface{}{}
+		for k, child := range m {
+			if e.opts.EnableFileInclude {
+				if str, isStr := child.(string); isStr {
+					if match := includeRefRe.FindStringSubmatch(str); match != nil {
+						included, err := e.resolveInclude(match[1], depth)
+						if err != nil {
+							unresolved = append(unresolved, str)
+							out[k] = child
+							continue
+						}
+						out[k] = included
+						continue
+					}
+				}
+			}
+			expandedChild, childUnresolved := e.expandNode(child, depth)
+			out[k] = expandedChild
+			unresolved = append(unresolved, childUnresolved...)
+		}
+		return out, unresolved
+	}
+
+	if arr, isArr := v.([]interface{}); isArr {
+		out := make([]interface{}, len(arr))
+		for i, item := range arr {
+			expandedItem, itemUnresolved := e.expandNode(item, depth)
+			out[i] = expandedItem
+			unresolved = append(unresolved, itemUnresolved...)
+		}
+		return out, unresolved
+	}
+
+	if str, isStr := v.(string); isStr {
+		return e.expandString(str, depth)
+	}
+
+	return v, unresolved
+}
+
+func (e *expander) expandString(str string, depth int) (string, []string) {
+	unresolved := []string{}
+
+	if e.opts.EnableEnv {
+		str = envRefRe.ReplaceAllStringFunc(str, func(m string) string {
+			parts := envRefRe.FindStringSubmatch(m)
+			name := parts[1]
+			if val, ok := os.LookupEnv(name); ok {
+				return val
+			}
+			if parts[2] != "" {
+				return parts[3]
+			}
+			unresolved = append(unresolved, m)
+			return m
+		})
+	}
+
+	if e.opts.EnableRefs {
+		str = pathRefRe.ReplaceAllStringFunc(str, func(m string) string {
+			path := pathRefRe.FindStringSubmatch(m)[1]
+			val, typ := e.sjyb.GetNodeByPath(path)
+			if typ == e.sjyb.Config.NotFoundOrInvalidNotation {
+				unresolved = append(unresolved, m)
+				return m
+			}
+			return fmt.Sprintf("%v", val)
+		})
+	}
+
+	if e.opts.EnableFileInclude {
+		str = fileRefRe.ReplaceAllStringFunc(str, func(m string) string {
+			parts := fileRefRe.FindStringSubmatch(m)
+			resolved, err := e.resolveFileRef(parts[1], parts[3], depth)
+			if err != nil {
+				unresolved = append(unresolved, m)
+				return m
+			}
+			return fmt.Sprintf("%v", resolved)
+		})
+	}
+
+	return str, unresolved
+}
+
+func (e *expander) resolvePath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	return filepath.Join(e.opts.BaseDir, filename)
+}
+
+func (e *expander) parseFile(filename string, depth int) (SmartJsonYamlBase, error) {
+	if depth >= e.opts.MaxDepth {
+		return SmartJsonYamlBase{}, fmt.Errorf("ExpandReferences: max depth %d exceeded while including %q", e.opts.MaxDepth, filename)
+	}
+	if e.opts.Parse == nil {
+		return SmartJsonYamlBase{}, fmt.Errorf("ExpandReferences: no Parse function configured for %q", filename)
+	}
+	full := e.resolvePath(filename)
+	if e.visitedFiles[full] {
+		return SmartJsonYamlBase{}, fmt.Errorf("ExpandReferences: cycle detected including %q", filename)
+	}
+	e.visitedFiles[full] = true
+	defer delete(e.visitedFiles, full)
+
+	included, err := e.opts.Parse(full)
+	if err != nil {
+		return SmartJsonYamlBase{}, err
+	}
+	included.Config = e.sjyb.Config
+
+	childExpander := &expander{sjyb: &included, opts: e.opts, visitedFiles: e.visitedFiles}
+	expanded, unresolved := childExpander.expandNode(included.ParsedData, depth+1)
+	included.ParsedData = expanded
+	if len(unresolved) > 0 {
+		return SmartJsonYamlBase{}, &UnresolvedReferenceError{Refs: unresolved}
+	}
+	return included, nil
+}
+
+func (e *expander) resolveFileRef(filename string, subPath string, depth int) (interface{}, error) {
+	included, err := e.parseFile(filename, depth)
+	if err != nil {
+		return nil, err
+	}
+	if subPath == "" {
+		return included.ParsedData, nil
+	}
+	val, typ := included.GetNodeByPath(subPath)
+	if typ == included.Config.NotFoundOrInvalidNotation {
+		return nil, fmt.Errorf("ExpandReferences: %q has no node at %q", filename, subPath)
+	}
+	return val, nil
+}
+
+func (e *expander) resolveInclude(filename string, depth int) (interface{}, error) {
+	included, err := e.parseFile(filename, depth)
+	if err != nil {
+		return nil, err
+	}
+	return included.ParsedData, nil
+}
@@ -0,0 +1,80 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandReferencesEnv(t *testing.T) {
+	os.Setenv("SMARTJSONYAMLSTUB_TEST_VAR", "hello")
+	defer os.Unsetenv("SMARTJSONYAMLSTUB_TEST_VAR")
+
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"greeting": "${ENV:SMARTJSONYAMLSTUB_TEST_VAR}",
+		"fallback": "${ENV:SMARTJSONYAMLSTUB_MISSING_VAR:-default}",
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ExpandReferences(ExpandOptions{EnableEnv: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := sjyb.ParsedData.(map[string]interface{})
+	if m["greeting"] != "hello" {
+		t.Errorf("expected ENV expansion, got %v", m["greeting"])
+	}
+	if m["fallback"] != "default" {
+		t.Errorf("expected default fallback, got %v", m["fallback"])
+	}
+}
+
+func TestExpandReferencesEnvMissingIsUnresolved(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"x": "${ENV:SMARTJSONYAMLSTUB_DEFINITELY_MISSING}",
+	}}
+	sjyb.Config.InitConfig()
+
+	err := sjyb.ExpandReferences(ExpandOptions{EnableEnv: true})
+	if err == nil {
+		t.Fatalf("expected an UnresolvedReferenceError")
+	}
+	unresolved, ok := err.(*UnresolvedReferenceError)
+	if !ok || len(unresolved.Refs) != 1 {
+		t.Fatalf("expected one unresolved reference, got %v", err)
+	}
+}
+
+func TestExpandReferencesPath(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"base": "localhost",
+		"url":  "http://${PATH:base}/",
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ExpandReferences(ExpandOptions{EnableRefs: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := sjyb.ParsedData.(map[string]interface{})
+	if m["url"] != "http://localhost/" {
+		t.Errorf("expected PATH expansion, got %v", m["url"])
+	}
+}
+
+func TestExpandReferencesDisabledFeatureIsLeftUntouched(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"x": "${ENV:HOME}",
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ExpandReferences(ExpandOptions{}); err != nil {
+		t.Fatalf("expected no error when EnableEnv is off, got %v", err)
+	}
+	m := sjyb.ParsedData.(map[string]interface{})
+	if m["x"] != "${ENV:HOME}" {
+		t.Errorf("expected disabled feature to leave the literal token untouched, got %v", m["x"])
+	}
+}
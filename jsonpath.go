@@ -0,0 +1,426 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// pathStepKind identifies the kind of a single parsed path step
+type pathStepKind int
+
+const (
+	pathStepKey pathStepKind = iota
+	pathStepIndex
+	pathStepWildcard
+	pathStepDescend
+	pathStepSlice
+	pathStepUnion
+	pathStepFilter
+)
+
+// pathStep is one parsed segment of a query path (e.g. a key lookup, a
+// wildcard, a slice or a filter expression)
+type pathStep struct {
+	kind       pathStepKind
+	key        string
+	index      int
+	sliceStart int
+	sliceEnd   int
+	sliceStep  int
+	union      []int
+	filter     string
+}
+
+// isAdvancedPath returns true when the given (already prefix-stripped) path
+// contains a construct only the QueryNodesByPath engine understands:
+// wildcards, recursive descent, slices, unions or filter expressions.
+func isAdvancedPath(p string) bool {
+	return strings.Contains(p, "*") ||
+		strings.Contains(p, "..") ||
+		strings.Contains(p, ":") ||
+		strings.Contains(p, ",") ||
+		strings.Contains(p, "?(")
+}
+
+// parseQueryPath splits a preprocessed path (slash separated, possibly
+// containing "..", "*", "[...]" segments) into a slice of pathStep
+func parseQueryPath(p string) []pathStep {
+	steps := []pathStep{}
+	for p != "" {
+		if strings.HasPrefix(p, "../") {
+			steps = append(steps, pathStep{kind: pathStepDescend})
+			p = p[3:]
+			continue
+		}
+		if p == ".." {
+			steps = append(steps, pathStep{kind: pathStepDescend})
+			break
+		}
+
+		sep := strings.Index(p, "/")
+		var seg string
+		if sep == -1 {
+			seg = p
+			p = ""
+		} else {
+			seg = p[:sep]
+			p = p[sep+1:]
+		}
+		if seg == "" {
+			continue
+		}
+		steps = append(steps, parseQueryStep(seg))
+	}
+	return steps
+}
+
+func parseQueryStep(seg string) pathStep {
+	if seg == "*" || seg == "[*]" {
+		return pathStep{kind: pathStepWildcard}
+	}
+	if strings.HasPrefix(seg, "[?(") && strings.HasSuffix(seg, ")]") {
+		return pathStep{kind: pathStepFilter, filter: seg[3 : len(seg)-2]}
+	}
+	if strings.HasPrefix(seg, "[") && strings.HasSuffix(seg, "]") {
+		inner := seg[1 : len(seg)-1]
+		if strings.Contains(inner, ":") {
+			return parseSliceStep(inner)
+		}
+		if strings.Contains(inner, ",") {
+			return parseUnionStep(inner)
+		}
+		if idx, err := strconv.Atoi(inner); err == nil {
+			return pathStep{kind: pathStepIndex, index: idx}
+		}
+	}
+	return pathStep{kind: pathStepKey, key: seg}
+}
+
+func parseSliceStep(inner string) pathStep {
+	parts := strings.Split(inner, ":")
+	step := pathStep{kind: pathStepSlice, sliceStart: 0, sliceEnd: -1, sliceStep: 1}
+	if len(parts) > 0 && parts[0] != "" {
+		if v, err := strconv.Atoi(parts[0]); err == nil {
+			step.sliceStart = v
+		}
+	}
+	if len(parts) > 1 && parts[1] != "" {
+		if v, err := strconv.Atoi(parts[1]); err == nil {
+			step.sliceEnd = v
+		}
+	}
+	if len(parts) > 2 && parts[2] != "" {
+		if v, err := strconv.Atoi(parts[2]); err == nil {
+			step.sliceStep = v
+		}
+	}
+	return step
+}
+
+func parseUnionStep(inner string) pathStep {
+	step := pathStep{kind: pathStepUnion}
+	for _, part := range strings.Split(inner, ",") {
+		part = strings.TrimSpace(part)
+		if v, err := strconv.Atoi(part); err == nil {
+			step.union = append(step.union, v)
+		}
+	}
+	return step
+}
+
+// queryCandidate pairs a node with the path string used to reach it, so
+// filter expressions can be re-evaluated relative to "@"
+type queryCandidate struct {
+	node interface{}
+	path string
+}
+
+// QueryNodesByPath evaluates a JSONPath-style query against ParsedData and
+// returns every matching node together with the concrete path (in the
+// module's "/a/[0]/b" notation) that led to it. It supports wildcards (*),
+// recursive descent (..), array slices ([start:end:step]), union indexes
+// ([0,2,4]) and filter expressions ([?(@.field == "x")]) in addition to the
+// plain key/index steps already understood by GetNodeByPath.
+func (sjyb SmartJsonYamlBase) QueryNodesByPath(path string) ([]interface{}, []string) {
+	steps := parseQueryPath(pathPreprocess(path))
+	candidates := []queryCandidate{{node: sjyb.ParsedData, path: ""}}
+
+	for _, step := range steps {
+		next := []queryCandidate{}
+		for _, c := range candidates {
+			next = append(next, sjyb.applyQueryStep(step, c)...)
+		}
+		candidates = next
+	}
+
+	nodes := make([]interface{}, 0, len(candidates))
+	paths := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		nodes = append(nodes, c.node)
+		paths = append(paths, c.path)
+	}
+	return nodes, paths
+}
+
+func (sjyb SmartJsonYamlBase) applyQueryStep(step pathStep, c queryCandidate) []queryCandidate {
+	switch step.kind {
+	case pathStepKey:
+		if m, isMap := c.node.(map[string]interface{}); isMap {
+			if v, ok := m[step.key]; ok {
+				return []queryCandidate{{node: v, path: joinPath(c.path, step.key)}}
+			}
+		}
+		return nil
+	case pathStepIndex:
+		if a, isArr := c.node.([]interface{}); isArr && step.index >= 0 && step.index < len(a) {
+			return []queryCandidate{{node: a[step.index], path: joinPath(c.path, indexSeg(step.index))}}
+		}
+		return nil
+	case pathStepWildcard:
+		return sjyb.wildcardChildren(c)
+	case pathStepDescend:
+		return sjyb.descendants(c)
+	case pathStepSlice:
+		return sjyb.sliceChildren(step, c)
+	case pathStepUnion:
+		out := []queryCandidate{}
+		for _, idx := range step.union {
+			if a, isArr := c.node.([]interface{}); isArr && idx >= 0 && idx < len(a) {
+				out = append(out, queryCandidate{node: a[idx], path: joinPath(c.path, indexSeg(idx))})
+			}
+		}
+		return out
+	case pathStepFilter:
+		return sjyb.filterChildren(step.filter, c)
+	}
+	return nil
+}
+
+func joinPath(base string, seg string) string {
+	if base == "" {
+		return seg
+	}
+	if strings.HasPrefix(seg, "[") {
+		return base + "/" + seg
+	}
+	return base + "/" + seg
+}
+
+func indexSeg(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+func (sjyb SmartJsonYamlBase) wildcardChildren(c queryCandidate) []queryCandidate {
+	out := []queryCandidate{}
+	if m, isMap := c.node.(map[string]interface{}); isMap {
+		for k, v := range m {
+			out = append(out, queryCandidate{node: v, path: joinPath(c.path, k)})
+		}
+		return out
+	}
+	if a, isArr := c.node.([]interface{}); isArr {
+		for i, v := range a {
+			out = append(out, queryCandidate{node: v, path: joinPath(c.path, indexSeg(i))})
+		}
+		return out
+	}
+	return out
+}
+
+// descendants does a BFS collection of c itself plus every descendant node
+func (sjyb SmartJsonYamlBase) descendants(c queryCandidate) []queryCandidate {
+	out := []queryCandidate{c}
+	queue := []queryCandidate{c}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		children := sjyb.wildcardChildren(cur)
+		out = append(out, children...)
+		queue = append(queue, children...)
+	}
+	return out
+}
+
+func (sjyb SmartJsonYamlBase) sliceChildren(step pathStep, c queryCandidate) []queryCandidate {
+	a, isArr := c.node.([]interface{})
+	if !isArr {
+		return nil
+	}
+	start, end, stp := normalizeSlice(step, len(a))
+	out := []queryCandidate{}
+	if stp > 0 {
+		for i := start; i < end; i += stp {
+			out = append(out, queryCandidate{node: a[i], path: joinPath(c.path, indexSeg(i))})
+		}
+	} else if stp < 0 {
+		for i := start; i > end; i += stp {
+			out = append(out, queryCandidate{node: a[i], path: joinPath(c.path, indexSeg(i))})
+		}
+	}
+	return out
+}
+
+func normalizeSlice(step pathStep, length int) (start int, end int, stp int) {
+	stp = step.sliceStep
+	if stp == 0 {
+		stp = 1
+	}
+	start = step.sliceStart
+	if start < 0 {
+		start += length
+	}
+	end = step.sliceEnd
+	if step.sliceEnd == -1 {
+		if stp > 0 {
+			end = length
+		} else {
+			end = -1
+		}
+	} else if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > length {
+		start = length
+	}
+	if end > length {
+		end = length
+	}
+	return start, end, stp
+}
+
+// filterChildren evaluates a "[?(@.field OP value)]" style expression
+// (with optional && / || composition) against each element of an array,
+// re-using GetNodeByPath against "@" for the field lookup
+func (sjyb SmartJsonYamlBase) filterChildren(expr string, c queryCandidate) []queryCandidate {
+	a, isArr := c.node.([]interface{})
+	if !isArr {
+		return nil
+	}
+	out := []queryCandidate{}
+	for i, item := range a {
+		if evalFilterExpr(expr, item) {
+			out = append(out, queryCandidate{node: item, path: joinPath(c.path, indexSeg(i))})
+		}
+	}
+	return out
+}
+
+func evalFilterExpr(expr string, item interface{}) bool {
+	if idx := strings.Index(expr, "&&"); idx != -1 {
+		return evalFilterExpr(expr[:idx], item) && evalFilterExpr(expr[idx+2:], item)
+	}
+	if idx := strings.Index(expr, "||"); idx != -1 {
+		return evalFilterExpr(expr[:idx], item) || evalFilterExpr(expr[idx+2:], item)
+	}
+	return evalFilterTerm(strings.TrimSpace(expr), item)
+}
+
+var filterOperators = []string{">=", "<=", "!=", "==", ">", "<"}
+
+func evalFilterTerm(term string, item interface{}) bool {
+	for _, op := range filterOperators {
+		if idx := strings.Index(term, op); idx != -1 {
+			field := strings.TrimSpace(term[:idx])
+			rawVal := strings.TrimSpace(term[idx+len(op):])
+			return evalFilterCompare(field, op, rawVal, item)
+		}
+	}
+	// bare "@.field" presence test
+	field := strings.TrimSpace(term)
+	val := lookupFilterField(field, item)
+	return val != nil
+}
+
+func evalFilterCompare(field string, op string, rawVal string, item interface{}) bool {
+	left := lookupFilterField(field, item)
+	right := parseFilterLiteral(rawVal)
+
+	switch op {
+	case "==":
+		return filterEquals(left, right)
+	case "!=":
+		return !filterEquals(left, right)
+	}
+
+	lf, lok := toFilterFloat(left)
+	rf, rok := toFilterFloat(right)
+	if !lok || !rok {
+		return false
+	}
+	switch op {
+	case ">":
+		return lf > rf
+	case "<":
+		return lf < rf
+	case ">=":
+		return lf >= rf
+	case "<=":
+		return lf <= rf
+	}
+	return false
+}
+
+func lookupFilterField(field string, item interface{}) interface{} {
+	field = strings.TrimPrefix(field, "@")
+	field = strings.TrimPrefix(field, ".")
+	if field == "" {
+		return item
+	}
+	tmp := SmartJsonYamlBase{ParsedData: item}
+	tmp.Config.InitConfig()
+	v, typ := tmp.GetNodeByPath(field)
+	if typ == tmp.Config.NotFoundOrInvalidNotation {
+		return nil
+	}
+	return v
+}
+
+func parseFilterLiteral(raw string) interface{} {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 && (raw[0] == '"' || raw[0] == '\'') && raw[len(raw)-1] == raw[0] {
+		return raw[1 : len(raw)-1]
+	}
+	if raw == "true" {
+		return true
+	}
+	if raw == "false" {
+		return false
+	}
+	if f, err := strconv.ParseFloat(raw, 64); err == nil {
+		return f
+	}
+	return raw
+}
+
+// filterEquals compares two decoded JSON/YAML values for equality. It
+// special-cases numbers (so int and float64 representations of the same
+// value compare equal) and falls back to reflect.DeepEqual for everything
+// else, since maps and slices are not comparable with == and a naive "=="
+// would panic at runtime.
+func filterEquals(left interface{}, right interface{}) bool {
+	if lf, lok := toFilterFloat(left); lok {
+		if rf, rok := toFilterFloat(right); rok {
+			return lf == rf
+		}
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func toFilterFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
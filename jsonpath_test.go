@@ -0,0 +1,97 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import "testing"
+
+func sampleManifest() map[string]interface{} {
+	return map[string]interface{}{
+		"containers": []interface{}{
+			map[string]interface{}{"name": "web", "image": "nginx:latest", "cpu": 1.0},
+			map[string]interface{}{"name": "sidecar", "image": "envoy:v2", "cpu": 2.0},
+		},
+	}
+}
+
+func TestQueryNodesByPathWildcard(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	nodes, paths := sjyb.QueryNodesByPath("containers/*/image")
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 image nodes, got %d (%v)", len(nodes), nodes)
+	}
+	if nodes[0] != "nginx:latest" && nodes[1] != "nginx:latest" {
+		t.Errorf("expected one of the nodes to be nginx:latest, got %v", nodes)
+	}
+	for _, p := range paths {
+		if p == "" {
+			t.Errorf("expected non-empty path for each match")
+		}
+	}
+}
+
+func TestQueryNodesByPathRecursiveDescent(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	nodes, _ := sjyb.QueryNodesByPath("../name")
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 name nodes via recursive descent, got %d (%v)", len(nodes), nodes)
+	}
+}
+
+func TestQueryNodesByPathSlice(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"items": []interface{}{0, 1, 2, 3, 4},
+	}}
+	sjyb.Config.InitConfig()
+
+	nodes, _ := sjyb.QueryNodesByPath("items/[1:4]")
+	if len(nodes) != 3 || nodes[0] != 1 || nodes[2] != 3 {
+		t.Fatalf("expected slice [1,2,3], got %v", nodes)
+	}
+}
+
+func TestQueryNodesByPathFilter(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	nodes, _ := sjyb.QueryNodesByPath(`containers/[?(@.cpu > 1)]/name`)
+	if len(nodes) != 1 || nodes[0] != "sidecar" {
+		t.Fatalf("expected only the sidecar container to match cpu > 1, got %v", nodes)
+	}
+}
+
+func TestQueryNodesByPathDollarPrefixRecursiveDescent(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	nodes, _ := sjyb.QueryNodesByPath("$..name")
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 name nodes via \"$..\" recursive descent, got %d (%v)", len(nodes), nodes)
+	}
+}
+
+func TestQueryNodesByPathDollarPrefixFilter(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	nodes, _ := sjyb.QueryNodesByPath(`$.containers[?(@.cpu>1)].name`)
+	if len(nodes) != 1 || nodes[0] != "sidecar" {
+		t.Fatalf("expected only the sidecar container to match cpu > 1, got %v", nodes)
+	}
+}
+
+func TestGetNodeByPathStillWorksForPlainPaths(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: sampleManifest()}
+	sjyb.Config.InitConfig()
+
+	v, typ := sjyb.GetNodeByPath("containers/[0]/name")
+	if typ != "string" || v != "web" {
+		t.Fatalf("expected plain path lookup to keep working, got %v/%s", v, typ)
+	}
+}
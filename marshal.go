@@ -0,0 +1,343 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const structTagName = "smartjsonyaml"
+
+// fieldPlan is the resolved marshal/unmarshal plan for one struct field:
+// the node name it is matched against, and whether a zero value should be
+// omitted on Marshal. An untagged embedded struct has no plan of its own;
+// its fields are listed in its place, with the embedding field's index
+// prefixed to theirs.
+type fieldPlan struct {
+	index     []int
+	name      string
+	omitempty string
+	embedded  bool
+}
+
+func (p fieldPlan) omitEmpty() bool {
+	return p.omitempty == "omitempty"
+}
+
+// fieldPlans lists the usable fields of t in declaration order, resolving
+// embedded structs into their parent's field list.
+func fieldPlans(t reflect.Type) []fieldPlan {
+	plans := []fieldPlan{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue // unexported
+		}
+
+		tag, hasTag := f.Tag.Lookup(structTagName)
+		if !hasTag {
+			tag, hasTag = f.Tag.Lookup("json")
+		}
+		name := f.Name
+		omitempty := ""
+		if hasTag {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				omitempty = parts[1]
+			}
+		}
+
+		if f.Anonymous && derefType(f.Type).Kind() == reflect.Struct && !hasTag {
+			for _, sub := range fieldPlans(derefType(f.Type)) {
+				sub.index = append([]int{i}, sub.index...)
+				plans = append(plans, sub)
+			}
+			continue
+		}
+
+		plans = append(plans, fieldPlan{index: []int{i}, name: name, omitempty: omitempty})
+	}
+	return plans
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Unmarshal decodes ParsedData into v, which must be a non-nil pointer to a
+// struct. Fields are matched using the `smartjsonyaml:"field,omitempty"`
+// struct tag, falling back to the `json:` tag and then to the field name.
+// Embedded structs, time.Time, pointers and encoding.TextUnmarshaler are
+// supported.
+func (sjyb SmartJsonYamlBase) Unmarshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("Unmarshal: v must be a non-nil pointer, got %T", v)
+	}
+	return decodeValue(sjyb.ParsedData, rv.Elem())
+}
+
+func decodeValue(node interface{}, dst reflect.Value) error {
+	if node == nil {
+		return nil
+	}
+
+	if dst.Kind() == reflect.Ptr {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(node, dst.Elem())
+	}
+
+	if dst.Type() == timeType {
+		return decodeTime(node, dst)
+	}
+
+	if reflect.PtrTo(dst.Type()).Implements(textUnmarshalerType) {
+		if str, isStr := node.(string); isStr {
+			return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str))
+		}
+	}
+
+	switch dst.Kind() {
+	case reflect.Struct:
+		m, isMap := node.(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("Unmarshal: expected a map for struct %s, got %T", dst.Type(), node)
+		}
+		for _, plan := range fieldPlans(dst.Type()) {
+			child, ok := m[plan.name]
+			if !ok {
+				continue
+			}
+			if err := decodeValue(child, dst.FieldByIndex(plan.index)); err != nil {
+				return fmt.Errorf("Unmarshal: field %q: %w", plan.name, err)
+			}
+		}
+		return nil
+	case reflect.Slice:
+		arr, isArr := node.([]interface{})
+		if !isArr {
+			return fmt.Errorf("Unmarshal: expected an array for %s, got %T", dst.Type(), node)
+		}
+		out := reflect.MakeSlice(dst.Type(), len(arr), len(arr))
+		for i, item := range arr {
+			if err := decodeValue(item, out.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(out)
+		return nil
+	case reflect.Map:
+		m, isMap := node.(map[string]interface{})
+		if !isMap {
+			return fmt.Errorf("Unmarshal: expected a map for %s, got %T", dst.Type(), node)
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, v := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := decodeValue(v, elem); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k), elem)
+		}
+		dst.Set(out)
+		return nil
+	case reflect.String:
+		str, isStr := node.(string)
+		if !isStr {
+			return fmt.Errorf("Unmarshal: expected a string, got %T", node)
+		}
+		dst.SetString(str)
+		return nil
+	case reflect.Bool:
+		b, isBool := node.(bool)
+		if !isBool {
+			return fmt.Errorf("Unmarshal: expected a bool, got %T", node)
+		}
+		dst.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f, ok := toFilterFloat(node)
+		if !ok {
+			return fmt.Errorf("Unmarshal: expected a number, got %T", node)
+		}
+		dst.SetInt(int64(f))
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f, ok := toFilterFloat(node)
+		if !ok {
+			return fmt.Errorf("Unmarshal: expected a number, got %T", node)
+		}
+		dst.SetUint(uint64(f))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFilterFloat(node)
+		if !ok {
+			return fmt.Errorf("Unmarshal: expected a number, got %T", node)
+		}
+		dst.SetFloat(f)
+		return nil
+	case reflect.Interface:
+		dst.Set(reflect.ValueOf(node))
+		return nil
+	}
+	return fmt.Errorf("Unmarshal: unsupported destination kind %s", dst.Kind())
+}
+
+func decodeTime(node interface{}, dst reflect.Value) error {
+	if tv, isTime := node.(time.Time); isTime {
+		dst.Set(reflect.ValueOf(tv))
+		return nil
+	}
+	str, isStr := node.(string)
+	if !isStr {
+		return fmt.Errorf("Unmarshal: expected a time.Time or string, got %T", node)
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if tv, err := time.Parse(layout, str); err == nil {
+			dst.Set(reflect.ValueOf(tv))
+			return nil
+		}
+	}
+	return fmt.Errorf("Unmarshal: %q does not match any supported time layout", str)
+}
+
+// Marshal encodes v, which must be a struct or a pointer to one, into
+// ParsedData using the same tag rules as Unmarshal.
+func (sjyb *SmartJsonYamlBase) Marshal(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			sjyb.ParsedData = nil
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("Marshal: v must be a struct or pointer to struct, got %T", v)
+	}
+	encoded, err := encodeValue(rv)
+	if err != nil {
+		return err
+	}
+	sjyb.ParsedData = encoded
+	return nil
+}
+
+func encodeValue(src reflect.Value) (interface{}, error) {
+	if src.Kind() == reflect.Ptr {
+		if src.IsNil() {
+			return nil, nil
+		}
+		return encodeValue(src.Elem())
+	}
+
+	if src.Type() == timeType {
+		return src.Interface().(time.Time), nil
+	}
+
+	if src.CanAddr() && src.Addr().Type().Implements(textMarshalerType) {
+		b, err := src.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+
+	switch src.Kind() {
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		for _, plan := range fieldPlans(src.Type()) {
+			fv := src.FieldByIndex(plan.index)
+			if plan.omitEmpty() && fv.IsZero() {
+				continue
+			}
+			encoded, err := encodeValue(fv)
+			if err != nil {
+				return nil, fmt.Errorf("Marshal: field %q: %w", plan.name, err)
+			}
+			out[plan.name] = encoded
+		}
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, src.Len())
+		for i := 0; i < src.Len(); i++ {
+			encoded, err := encodeValue(src.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = encoded
+		}
+		return out, nil
+	case reflect.Map:
+		out := map[string]interface{}{}
+		for _, key := range src.MapKeys() {
+			encoded, err := encodeValue(src.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+			out[fmt.Sprintf("%v", key.Interface())] = encoded
+		}
+		return out, nil
+	case reflect.String:
+		return src.String(), nil
+	case reflect.Bool:
+		return src.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return int(src.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(src.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return src.Float(), nil
+	case reflect.Interface:
+		if src.IsNil() {
+			return nil, nil
+		}
+		return encodeValue(src.Elem())
+	}
+	return nil, fmt.Errorf("Marshal: unsupported field kind %s", src.Kind())
+}
+
+// PathConstName turns a "/" separated module path (e.g. "server/host")
+// into an exported Go identifier ("ServerHost"), as used by
+// cmd/smartjsonyamlgen when emitting typed accessor methods.
+func PathConstName(path string) string {
+	segs := strings.Split(path, "/")
+	var b strings.Builder
+	for _, seg := range segs {
+		if seg == "" {
+			continue
+		}
+		seg = strings.Trim(seg, "[]")
+		if _, err := strconv.Atoi(seg); err == nil {
+			b.WriteString("Item" + seg)
+			continue
+		}
+		b.WriteString(strings.ToUpper(seg[0:1]) + seg[1:])
+	}
+	return b.String()
+}
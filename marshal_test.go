@@ -0,0 +1,102 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"testing"
+	"time"
+)
+
+type marshalTestAddress struct {
+	City string `smartjsonyaml:"city"`
+}
+
+type marshalTestPerson struct {
+	marshalTestAddress
+	Name    string    `smartjsonyaml:"name"`
+	Age     int       `json:"age"`
+	Tags    []string  `smartjsonyaml:"tags,omitempty"`
+	Born    time.Time `smartjsonyaml:"born"`
+	Ignored string    `smartjsonyaml:"-"`
+}
+
+func TestUnmarshalIntoStruct(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"name": "Ada",
+		"age":  36,
+		"tags": []interface{}{"math", "computing"},
+		"born": "1815-12-10",
+		"city": "London",
+	}}
+	sjyb.Config.InitConfig()
+
+	var p marshalTestPerson
+	if err := sjyb.Unmarshal(&p); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if p.Name != "Ada" || p.Age != 36 || p.City != "London" {
+		t.Fatalf("unexpected decode result: %+v", p)
+	}
+	if len(p.Tags) != 2 || p.Tags[0] != "math" {
+		t.Fatalf("unexpected tags: %v", p.Tags)
+	}
+	if p.Born.Format("2006-01-02") != "1815-12-10" {
+		t.Fatalf("unexpected born date: %v", p.Born)
+	}
+}
+
+func TestMarshalFromStruct(t *testing.T) {
+	p := marshalTestPerson{
+		marshalTestAddress: marshalTestAddress{City: "Paris"},
+		Name:               "Grace",
+		Age:                85,
+		Born:               time.Date(1906, 12, 9, 0, 0, 0, 0, time.UTC),
+	}
+
+	var sjyb SmartJsonYamlBase
+	sjyb.Config.InitConfig()
+	if err := sjyb.Marshal(&p); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	m, isMap := sjyb.ParsedData.(map[string]interface{})
+	if !isMap {
+		t.Fatalf("expected Marshal to produce a map, got %T", sjyb.ParsedData)
+	}
+	if m["name"] != "Grace" || m["city"] != "Paris" {
+		t.Fatalf("unexpected encode result: %v", m)
+	}
+	if _, present := m["tags"]; present {
+		t.Fatalf("expected omitempty tags field to be omitted, got %v", m["tags"])
+	}
+	if _, present := m["Ignored"]; present {
+		t.Fatalf("expected tag \"-\" field to be skipped entirely")
+	}
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	original := marshalTestPerson{
+		marshalTestAddress: marshalTestAddress{City: "Berlin"},
+		Name:               "Alan",
+		Age:                41,
+		Tags:               []string{"computing"},
+		Born:               time.Date(1912, 6, 23, 0, 0, 0, 0, time.UTC),
+	}
+
+	var sjyb SmartJsonYamlBase
+	sjyb.Config.InitConfig()
+	if err := sjyb.Marshal(&original); err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var decoded marshalTestPerson
+	if err := sjyb.Unmarshal(&decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Name != original.Name || decoded.City != original.City || decoded.Age != original.Age {
+		t.Fatalf("round trip mismatch: got %+v, want %+v", decoded, original)
+	}
+}
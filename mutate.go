@@ -0,0 +1,466 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SetByPath sets the value of the json/yaml node specified by the path,
+// creating intermediate maps or arrays for any part of the path that does
+// not yet exist (or is currently nil). An array segment may also grow the
+// array it addresses: an index equal to its current length, or the RFC
+// 6901 append marker "-" (translated by jsonPointerToModulePath into the
+// array segment "[-]"), appends a new element. An error is returned when an
+// existing non-container node is found where a container would have to be
+// created, or when an array index is out of range.
+func (sjyb *SmartJsonYamlBase) SetByPath(path string, value interface{}) error {
+	parts := strings.Split(pathPreprocess(path), "/")
+	if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+		return fmt.Errorf("SetByPath: empty path")
+	}
+
+	if sjyb.ParsedData == nil {
+		sjyb.ParsedData = newContainerFor(parts[0])
+	}
+
+	cur := sjyb.ParsedData
+	setCur := func(v interface{}) { sjyb.ParsedData = v }
+	for i := 0; i < len(parts)-1; i++ {
+		next, nextSetCur, err := descendOrCreate(cur, setCur, parts[i], parts[i+1])
+		if err != nil {
+			return err
+		}
+		cur, setCur = next, nextSetCur
+	}
+
+	return setLeaf(cur, setCur, parts[len(parts)-1], value)
+}
+
+// descendOrCreate resolves one path segment under cur (a map or an array),
+// creating an intermediate map when it does not exist yet (or is nil), or
+// growing an array when seg addresses one past its end. setCur writes a
+// replacement value for cur back into its parent container; this is needed
+// because growing an array can reallocate its backing storage, so the
+// parent's reference to it has to be updated too. nextSeg decides whether a
+// freshly created container is a map or an array (a "[...]" next segment
+// implies an array).
+func descendOrCreate(cur interface{}, setCur func(interface{}), seg string, nextSeg string) (interface{}, func(interface{}), error) {
+	if m, isMap := cur.(map[string]interface{}); isMap {
+		v, ok := m[seg]
+		if !ok || v == nil {
+			v = newContainerFor(nextSeg)
+			m[seg] = v
+		}
+		return v, func(nv interface{}) { m[seg] = nv }, nil
+	}
+	if arr, isArr := cur.([]interface{}); isArr {
+		idx, err := arrayIndexForSet(seg, len(arr))
+		if err != nil {
+			return nil, nil, err
+		}
+		if idx == len(arr) {
+			arr = append(arr, nil)
+			setCur(arr)
+		}
+		if arr[idx] == nil {
+			arr[idx] = newContainerFor(nextSeg)
+		}
+		return arr[idx], func(nv interface{}) { arr[idx] = nv }, nil
+	}
+	return nil, nil, fmt.Errorf("SetByPath: cannot descend into non-container node at %q", seg)
+}
+
+func newContainerFor(nextSeg string) interface{} {
+	if strings.HasPrefix(nextSeg, "[") {
+		return []interface{}{}
+	}
+	return map[string]interface{}{}
+}
+
+// arrayIndex parses seg (an array segment like "[3]") against an array of
+// the given length. The index must already exist.
+func arrayIndex(seg string, length int) (int, error) {
+	idx, err := parseArrayIndex(seg)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 || idx >= length {
+		return 0, fmt.Errorf("SetByPath: array index %d out of range (len %d)", idx, length)
+	}
+	return idx, nil
+}
+
+// arrayIndexForSet parses seg against an array of the given length, the
+// same way arrayIndex does, except an index equal to length (one past the
+// end) is also valid: it is how both a plain "[N]" segment and the append
+// marker "[-]" (see jsonPointerToModulePath) say "append a new element
+// here".
+func arrayIndexForSet(seg string, length int) (int, error) {
+	if seg == "[-]" {
+		return length, nil
+	}
+	idx, err := parseArrayIndex(seg)
+	if err != nil {
+		return 0, err
+	}
+	if idx < 0 || idx > length {
+		return 0, fmt.Errorf("SetByPath: array index %d out of range (len %d)", idx, length)
+	}
+	return idx, nil
+}
+
+func parseArrayIndex(seg string) (int, error) {
+	if !strings.HasPrefix(seg, "[") || !strings.HasSuffix(seg, "]") {
+		return 0, fmt.Errorf("SetByPath: invalid array segment %q", seg)
+	}
+	inner := seg[1 : len(seg)-1]
+	if inner == "" {
+		return 0, fmt.Errorf("SetByPath: empty array index")
+	}
+	idx, err := strconv.Atoi(inner)
+	if err != nil {
+		return 0, fmt.Errorf("SetByPath: invalid array index %q", seg)
+	}
+	return idx, nil
+}
+
+// setLeaf writes value at the final path segment under cur. setCur writes
+// a replacement value for cur back into its parent container, needed when
+// seg grows an array (see descendOrCreate).
+func setLeaf(cur interface{}, setCur func(interface{}), seg string, value interface{}) error {
+	if m, isMap := cur.(map[string]interface{}); isMap {
+		m[seg] = value
+		return nil
+	}
+	if arr, isArr := cur.([]interface{}); isArr {
+		idx, err := arrayIndexForSet(seg, len(arr))
+		if err != nil {
+			return err
+		}
+		if idx == len(arr) {
+			arr = append(arr, nil)
+			setCur(arr)
+		}
+		arr[idx] = value
+		return nil
+	}
+	return fmt.Errorf("SetByPath: cannot set %q on non-container node", seg)
+}
+
+// DeleteByPath removes the json/yaml node specified by the path. Deleting a
+// map key is a no-op when the key does not exist; deleting an out-of-range
+// array index returns an error.
+func (sjyb *SmartJsonYamlBase) DeleteByPath(path string) error {
+	parts := strings.Split(pathPreprocess(path), "/")
+	if len(parts) == 0 || (len(parts) == 1 && parts[0] == "") {
+		return fmt.Errorf("DeleteByPath: empty path")
+	}
+
+	parentPath := strings.Join(parts[:len(parts)-1], "/")
+	last := parts[len(parts)-1]
+
+	var parent interface{}
+	if parentPath == "" {
+		parent = sjyb.ParsedData
+	} else {
+		var typ string
+		parent, typ = sjyb.GetNodeByPath(parentPath)
+		if typ == sjyb.Config.NotFoundOrInvalidNotation {
+			return fmt.Errorf("DeleteByPath: parent of %q does not exist", path)
+		}
+	}
+
+	if m, isMap := parent.(map[string]interface{}); isMap {
+		delete(m, last)
+		return nil
+	}
+	if arr, isArr := parent.([]interface{}); isArr {
+		idx, err := arrayIndex(last, len(arr))
+		if err != nil {
+			return err
+		}
+		newArr := append(arr[:idx:idx], arr[idx+1:]...)
+		if parentPath == "" {
+			sjyb.ParsedData = newArr
+			return nil
+		}
+		return sjyb.SetByPath(parentPath, newArr)
+	}
+	return fmt.Errorf("DeleteByPath: %q is not a container", parentPath)
+}
+
+// AppendToArrayByPath appends value to the array node specified by path.
+// If the node does not exist yet, a new array containing only value is
+// created at that path.
+func (sjyb *SmartJsonYamlBase) AppendToArrayByPath(path string, value interface{}) error {
+	node, typ := sjyb.GetNodeByPath(path)
+	if typ == sjyb.Config.NotFoundOrInvalidNotation {
+		return sjyb.SetByPath(path, []interface{}{value})
+	}
+	arr, isArr := node.([]interface{})
+	if !isArr {
+		return fmt.Errorf("AppendToArrayByPath: node at %q is not an array", path)
+	}
+	return sjyb.SetByPath(path, append(arr, value))
+}
+
+// InsertIntoArrayByPath inserts value into the array node specified by path
+// at the given index, shifting later elements to the right.
+func (sjyb *SmartJsonYamlBase) InsertIntoArrayByPath(path string, index int, value interface{}) error {
+	node, typ := sjyb.GetNodeByPath(path)
+	if typ == sjyb.Config.NotFoundOrInvalidNotation {
+		return fmt.Errorf("InsertIntoArrayByPath: node at %q does not exist", path)
+	}
+	arr, isArr := node.([]interface{})
+	if !isArr {
+		return fmt.Errorf("InsertIntoArrayByPath: node at %q is not an array", path)
+	}
+	if index < 0 || index > len(arr) {
+		return fmt.Errorf("InsertIntoArrayByPath: index %d out of range (len %d)", index, len(arr))
+	}
+	newArr := make([]interface{}, 0, len(arr)+1)
+	newArr = append(newArr, arr[:index]...)
+	newArr = append(newArr, value)
+	newArr = append(newArr, arr[index:]...)
+	return sjyb.SetByPath(path, newArr)
+}
+
+// PatchOp is a single RFC 6902 JSON Patch operation
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// ApplyJsonPatch applies an RFC 6902 JSON Patch document (a JSON array of
+// operations) to ParsedData. Paths use RFC 6901 JSON Pointer notation
+// ("/a/0/b") and are translated to the module's own "/a/[0]/b" notation.
+func (sjyb *SmartJsonYamlBase) ApplyJsonPatch(patchJson string) error {
+	var ops []PatchOp
+	if err := json.Unmarshal([]byte(patchJson), &ops); err != nil {
+		return fmt.Errorf("ApplyJsonPatch: %w", err)
+	}
+	for _, op := range ops {
+		op.Value = normalizeJsonNumbers(op.Value)
+		if err := sjyb.applyPatchOp(op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sjyb *SmartJsonYamlBase) applyPatchOp(op PatchOp) error {
+	path := jsonPointerToModulePath(op.Path)
+	switch op.Op {
+	case "add":
+		// an "add" at an existing array index inserts the value there,
+		// shifting later elements, instead of replacing the element
+		if cut := strings.LastIndex(path, "/"); cut != -1 {
+			if idx, err := parseArrayIndex(path[cut+1:]); err == nil {
+				parent, _ := sjyb.GetNodeByPath(path[:cut])
+				if arr, isArr := parent.([]interface{}); isArr && idx >= 0 && idx < len(arr) {
+					return sjyb.InsertIntoArrayByPath(path[:cut], idx, op.Value)
+				}
+			}
+		}
+		return sjyb.SetByPath(path, op.Value)
+	case "replace":
+		if _, typ := sjyb.GetNodeByPath(path); typ == sjyb.Config.NotFoundOrInvalidNotation {
+			return fmt.Errorf("ApplyJsonPatch: replace target %q does not exist", op.Path)
+		}
+		return sjyb.SetByPath(path, op.Value)
+	case "remove":
+		return sjyb.DeleteByPath(path)
+	case "move":
+		from := jsonPointerToModulePath(op.From)
+		v, typ := sjyb.GetNodeByPath(from)
+		if typ == sjyb.Config.NotFoundOrInvalidNotation {
+			return fmt.Errorf("ApplyJsonPatch: move source %q does not exist", op.From)
+		}
+		if err := sjyb.DeleteByPath(from); err != nil {
+			return err
+		}
+		return sjyb.SetByPath(path, v)
+	case "copy":
+		from := jsonPointerToModulePath(op.From)
+		v, typ := sjyb.GetNodeByPath(from)
+		if typ == sjyb.Config.NotFoundOrInvalidNotation {
+			return fmt.Errorf("ApplyJsonPatch: copy source %q does not exist", op.From)
+		}
+		return sjyb.SetByPath(path, v)
+	case "test":
+		v, _ := sjyb.GetNodeByPath(path)
+		if !filterEquals(v, op.Value) {
+			return fmt.Errorf("ApplyJsonPatch: test failed at %q", op.Path)
+		}
+		return nil
+	}
+	return fmt.Errorf("ApplyJsonPatch: unknown op %q", op.Op)
+}
+
+// jsonPointerToModulePath converts an RFC 6901 JSON Pointer ("/a/0/b") to
+// this module's own path notation ("a/[0]/b"). The RFC 6902 "-" segment
+// ("the nonexistent member after the last array element", used to append)
+// becomes the array segment "[-]", which SetByPath's arrayIndexForSet
+// resolves to "append a new element".
+func jsonPointerToModulePath(pointer string) string {
+	p := strings.TrimPrefix(pointer, "/")
+	if p == "" {
+		return ""
+	}
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		s = strings.ReplaceAll(s, "~1", "/")
+		s = strings.ReplaceAll(s, "~0", "~")
+		if s == "-" {
+			segs[i] = "[-]"
+		} else if _, err := strconv.Atoi(s); err == nil {
+			segs[i] = "[" + s + "]"
+		} else {
+			segs[i] = s
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// ApplyJsonMergePatch applies an RFC 7396 JSON Merge Patch document to
+// ParsedData: null values delete the corresponding key, objects are merged
+// recursively, and any other value (array or scalar) replaces the target
+// wholesale.
+func (sjyb *SmartJsonYamlBase) ApplyJsonMergePatch(mergeJson string) error {
+	var patch interface{}
+	if err := json.Unmarshal([]byte(mergeJson), &patch); err != nil {
+		return fmt.Errorf("ApplyJsonMergePatch: %w", err)
+	}
+	sjyb.ParsedData = mergePatch(sjyb.ParsedData, normalizeJsonNumbers(patch))
+	return nil
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchMap, patchIsMap := patch.(map[string]interface{})
+	if !patchIsMap {
+		return patch
+	}
+	targetMap, targetIsMap := target.(map[string]interface{})
+	if !targetIsMap {
+		targetMap = map[string]interface{}{}
+	}
+	result := map[string]interface{}{}
+	for k, v := range targetMap {
+		result[k] = v
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = mergePatch(result[k], v)
+	}
+	return result
+}
+
+// normalizeJsonNumbers converts the float64 numbers produced by
+// encoding/json into int where the value is integral, matching the type
+// convention the rest of this module uses for parsed numeric nodes.
+func normalizeJsonNumbers(v interface{}) interface{} {
+	switch n := v.(type) {
+	case map[string]interface{}:
+		out := map[string]interface{}{}
+		for k, val := range n {
+			out[k] = normalizeJsonNumbers(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(n))
+		for i, val := range n {
+			out[i] = normalizeJsonNumbers(val)
+		}
+		return out
+	case float64:
+		if n == float64(int(n)) {
+			return int(n)
+		}
+		return n
+	}
+	return v
+}
+
+// Diff produces a minimal RFC 6902 patch that transforms sjyb.ParsedData
+// into other.ParsedData.
+func (sjyb SmartJsonYamlBase) Diff(other SmartJsonYamlBase) []PatchOp {
+	return diffNodes("", sjyb.ParsedData, other.ParsedData)
+}
+
+func diffNodes(pointer string, a interface{}, b interface{}) []PatchOp {
+	aMap, aIsMap := a.(map[string]interface{})
+	bMap, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		return diffMaps(pointer, aMap, bMap)
+	}
+
+	aArr, aIsArr := a.([]interface{})
+	bArr, bIsArr := b.([]interface{})
+	if aIsArr && bIsArr {
+		return diffArrays(pointer, aArr, bArr)
+	}
+
+	if filterEquals(a, b) {
+		return nil
+	}
+	if a == nil {
+		return []PatchOp{{Op: "add", Path: pointer, Value: b}}
+	}
+	return []PatchOp{{Op: "replace", Path: pointer, Value: b}}
+}
+
+func diffMaps(pointer string, a map[string]interface{}, b map[string]interface{}) []PatchOp {
+	ops := []PatchOp{}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			ops = append(ops, PatchOp{Op: "remove", Path: pointer + "/" + jsonPointerEscape(k)})
+		}
+	}
+	for k, bv := range b {
+		childPointer := pointer + "/" + jsonPointerEscape(k)
+		av, ok := a[k]
+		if !ok {
+			ops = append(ops, PatchOp{Op: "add", Path: childPointer, Value: bv})
+			continue
+		}
+		ops = append(ops, diffNodes(childPointer, av, bv)...)
+	}
+	return ops
+}
+
+func diffArrays(pointer string, a []interface{}, b []interface{}) []PatchOp {
+	ops := []PatchOp{}
+	minLen := len(a)
+	if len(b) < minLen {
+		minLen = len(b)
+	}
+	for i := 0; i < minLen; i++ {
+		childPointer := pointer + "/" + strconv.Itoa(i)
+		ops = append(ops, diffNodes(childPointer, a[i], b[i])...)
+	}
+	for i := minLen; i < len(a); i++ {
+		ops = append(ops, PatchOp{Op: "remove", Path: pointer + "/" + strconv.Itoa(minLen)})
+	}
+	for i := minLen; i < len(b); i++ {
+		ops = append(ops, PatchOp{Op: "add", Path: pointer + "/" + strconv.Itoa(i), Value: b[i]})
+	}
+	return ops
+}
+
+func jsonPointerEscape(seg string) string {
+	seg = strings.ReplaceAll(seg, "~", "~0")
+	seg = strings.ReplaceAll(seg, "/", "~1")
+	return seg
+}
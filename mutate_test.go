@@ -0,0 +1,244 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import "testing"
+
+func TestApplyJsonPatchTestOpOnArray(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"a": []interface{}{1, 2, 3},
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ApplyJsonPatch(`[{"op":"test","path":"/a","value":[1,2,3]}]`); err != nil {
+		t.Fatalf("test op on matching array should not fail: %v", err)
+	}
+	if err := sjyb.ApplyJsonPatch(`[{"op":"test","path":"/a","value":[1,2,4]}]`); err == nil {
+		t.Fatalf("test op on non-matching array should fail")
+	}
+}
+
+func TestApplyJsonPatchTestOpOnObject(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"a": map[string]interface{}{"x": 1},
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ApplyJsonPatch(`[{"op":"test","path":"/a","value":{"x":1}}]`); err != nil {
+		t.Fatalf("test op on matching object should not fail: %v", err)
+	}
+	if err := sjyb.ApplyJsonPatch(`[{"op":"test","path":"/a","value":{"x":2}}]`); err == nil {
+		t.Fatalf("test op on non-matching object should fail")
+	}
+}
+
+func TestDiffOnArraysAndObjects(t *testing.T) {
+	a := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"list": []interface{}{1, 2, 3},
+		"obj":  map[string]interface{}{"x": 1},
+	}}
+	b := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"list": []interface{}{1, 2, 3},
+		"obj":  map[string]interface{}{"x": 1},
+	}}
+	if ops := a.Diff(b); len(ops) != 0 {
+		t.Fatalf("expected no diff ops for identical array/object values, got %v", ops)
+	}
+}
+
+func TestDiffOnChangedInput(t *testing.T) {
+	a := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"kept":    "same",
+		"changed": 1,
+		"removed": "gone",
+	}}
+	b := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"kept":    "same",
+		"changed": 2,
+		"added":   "new",
+	}}
+
+	ops := a.Diff(b)
+	byPath := map[string]PatchOp{}
+	for _, op := range ops {
+		byPath[op.Path] = op
+	}
+	if len(ops) != 3 {
+		t.Fatalf("expected 3 diff ops, got %v", ops)
+	}
+	if op, ok := byPath["/changed"]; !ok || op.Op != "replace" || op.Value != 2 {
+		t.Errorf("expected a replace op for /changed, got %v", byPath["/changed"])
+	}
+	if op, ok := byPath["/removed"]; !ok || op.Op != "remove" {
+		t.Errorf("expected a remove op for /removed, got %v", byPath["/removed"])
+	}
+	if op, ok := byPath["/added"]; !ok || op.Op != "add" || op.Value != "new" {
+		t.Errorf("expected an add op for /added, got %v", byPath["/added"])
+	}
+}
+
+func TestSetByPathCreatesIntermediateMaps(t *testing.T) {
+	var sjyb SmartJsonYamlBase
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.SetByPath("server/host", "localhost"); err != nil {
+		t.Fatalf("SetByPath failed: %v", err)
+	}
+	v, typ := sjyb.GetNodeByPath("server/host")
+	if typ != "string" || v != "localhost" {
+		t.Fatalf("expected server/host to be \"localhost\", got %v/%s", v, typ)
+	}
+}
+
+func TestSetByPathGrowsArraysAlongThePath(t *testing.T) {
+	var sjyb SmartJsonYamlBase
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.SetByPath("a/[0]/b", "x"); err != nil {
+		t.Fatalf("SetByPath into a fresh array element should grow the array, got: %v", err)
+	}
+	v, typ := sjyb.GetNodeByPath("a/[0]/b")
+	if typ != "string" || v != "x" {
+		t.Fatalf("expected a/[0]/b to be \"x\", got %v/%s", v, typ)
+	}
+
+	if err := sjyb.SetByPath("a/[1]/b", "y"); err != nil {
+		t.Fatalf("SetByPath appending a second array element failed: %v", err)
+	}
+	arr, typ := sjyb.GetNodeByPath("a")
+	if typ != "array" || len(arr.([]interface{})) != 2 {
+		t.Fatalf("expected a to hold 2 elements, got %v/%s", arr, typ)
+	}
+}
+
+func TestDeleteByPath(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"keep": "yes",
+		"drop": "no",
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.DeleteByPath("drop"); err != nil {
+		t.Fatalf("DeleteByPath failed: %v", err)
+	}
+	if sjyb.NodeExists("drop") {
+		t.Fatalf("expected drop to be gone after DeleteByPath")
+	}
+	if !sjyb.NodeExists("keep") {
+		t.Fatalf("expected keep to survive DeleteByPath")
+	}
+}
+
+func TestAppendToArrayByPath(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"list": []interface{}{1, 2},
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.AppendToArrayByPath("list", 3); err != nil {
+		t.Fatalf("AppendToArrayByPath failed: %v", err)
+	}
+	v, _ := sjyb.GetNodeByPath("list")
+	arr := v.([]interface{})
+	if len(arr) != 3 || arr[2] != 3 {
+		t.Fatalf("expected list to be [1 2 3], got %v", arr)
+	}
+}
+
+func TestInsertIntoArrayByPath(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"list": []interface{}{1, 3},
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.InsertIntoArrayByPath("list", 1, 2); err != nil {
+		t.Fatalf("InsertIntoArrayByPath failed: %v", err)
+	}
+	v, _ := sjyb.GetNodeByPath("list")
+	arr := v.([]interface{})
+	if len(arr) != 3 || arr[0] != 1 || arr[1] != 2 || arr[2] != 3 {
+		t.Fatalf("expected list to be [1 2 3], got %v", arr)
+	}
+}
+
+func TestApplyJsonPatchAddAppendMarker(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"arr": []interface{}{1, 2, 3},
+	}}
+	sjyb.Config.InitConfig()
+
+	if err := sjyb.ApplyJsonPatch(`[{"op":"add","path":"/arr/-","value":4}]`); err != nil {
+		t.Fatalf("add with the \"-\" append marker should append, got: %v", err)
+	}
+	v, _ := sjyb.GetNodeByPath("arr")
+	arr := v.([]interface{})
+	if len(arr) != 4 || arr[3] != 4 {
+		t.Fatalf("expected arr to be [1 2 3 4], got %v", arr)
+	}
+}
+
+func TestApplyJsonPatchReplaceRemoveMoveCopy(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"a": "old",
+		"b": "move-me",
+		"c": "copy-me",
+	}}
+	sjyb.Config.InitConfig()
+
+	patch := `[
+		{"op":"replace","path":"/a","value":"new"},
+		{"op":"move","from":"/b","path":"/moved"},
+		{"op":"copy","from":"/c","path":"/copied"},
+		{"op":"remove","path":"/c"}
+	]`
+	if err := sjyb.ApplyJsonPatch(patch); err != nil {
+		t.Fatalf("ApplyJsonPatch failed: %v", err)
+	}
+	if v, _ := sjyb.GetNodeByPath("a"); v != "new" {
+		t.Errorf("expected a to be replaced with \"new\", got %v", v)
+	}
+	if sjyb.NodeExists("b") {
+		t.Errorf("expected b to be gone after move")
+	}
+	if v, _ := sjyb.GetNodeByPath("moved"); v != "move-me" {
+		t.Errorf("expected moved to hold \"move-me\", got %v", v)
+	}
+	if sjyb.NodeExists("c") {
+		t.Errorf("expected c to be gone after remove")
+	}
+	if v, _ := sjyb.GetNodeByPath("copied"); v != "copy-me" {
+		t.Errorf("expected copied to hold \"copy-me\", got %v", v)
+	}
+}
+
+func TestApplyJsonMergePatch(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"kept":    "yes",
+		"removed": "gone",
+		"nested":  map[string]interface{}{"a": 1, "b": 2},
+	}}
+	sjyb.Config.InitConfig()
+
+	err := sjyb.ApplyJsonMergePatch(`{"removed":null,"added":"new","nested":{"b":3}}`)
+	if err != nil {
+		t.Fatalf("ApplyJsonMergePatch failed: %v", err)
+	}
+	if sjyb.NodeExists("removed") {
+		t.Errorf("expected removed to be deleted by a null merge value")
+	}
+	if v, _ := sjyb.GetNodeByPath("kept"); v != "yes" {
+		t.Errorf("expected kept to survive the merge, got %v", v)
+	}
+	if v, _ := sjyb.GetNodeByPath("added"); v != "new" {
+		t.Errorf("expected added to be set by the merge, got %v", v)
+	}
+	if v, _ := sjyb.GetNodeByPath("nested/a"); v != 1 {
+		t.Errorf("expected nested/a to survive the recursive merge, got %v", v)
+	}
+	if v, _ := sjyb.GetNodeByPath("nested/b"); v != 3 {
+		t.Errorf("expected nested/b to be overwritten by the merge, got %v", v)
+	}
+}
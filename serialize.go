@@ -0,0 +1,439 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JsonTo streams a compacted, RFC 8259 compliant JSON representation of
+// ParsedData to w. Unlike JsonCompacted/JsonIndented it does not build the
+// whole document in memory first, and it returns an error instead of
+// silently emitting invalid JSON when a NaN/Inf float is encountered.
+func (sjyb SmartJsonYamlBase) JsonTo(w io.Writer) error {
+	return sjyb.jsonTo(w, false)
+}
+
+// JsonIndentedTo streams an indented, RFC 8259 compliant JSON representation
+// of ParsedData to w. See JsonTo.
+func (sjyb SmartJsonYamlBase) JsonIndentedTo(w io.Writer) error {
+	if err := sjyb.jsonTo(w, true); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (sjyb SmartJsonYamlBase) jsonTo(w io.Writer, prettyOutput bool) error {
+	return sjyb.jsonNodeTo(w, sjyb.ParsedData, "", prettyOutput)
+}
+
+func (sjyb SmartJsonYamlBase) jsonNodeTo(w io.Writer, v interface{}, indent string, prettyOutput bool) error {
+	if m, isMap := v.(map[string]interface{}); isMap {
+		return sjyb.jsonMapTo(w, m, indent, prettyOutput)
+	}
+	if arr, isArray := v.([]interface{}); isArray {
+		return sjyb.jsonArrayTo(w, arr, indent, prettyOutput)
+	}
+	if str, isStr := v.(string); isStr {
+		_, err := io.WriteString(w, "\""+jsonStringToOutput(str)+"\"")
+		return err
+	}
+	if intval, isInt := v.(int); isInt {
+		_, err := io.WriteString(w, strconv.Itoa(intval))
+		return err
+	}
+	if intval, isInt64 := v.(int64); isInt64 {
+		_, err := io.WriteString(w, strconv.FormatInt(intval, 10))
+		return err
+	}
+	if flt, isFlt := v.(float64); isFlt {
+		if math.IsNaN(flt) || math.IsInf(flt, 0) {
+			return fmt.Errorf("jsonTo: cannot encode non-finite float %v as JSON", flt)
+		}
+		_, err := io.WriteString(w, strconv.FormatFloat(flt, 'g', 10, 64))
+		return err
+	}
+	if timeval, isTime := v.(time.Time); isTime {
+		_, err := io.WriteString(w, "\""+jsonTimeString(timeval)+"\"")
+		return err
+	}
+	if num, isNum := v.(json.Number); isNum {
+		if _, err := strconv.ParseFloat(num.String(), 64); err != nil {
+			return fmt.Errorf("jsonTo: invalid json.Number %q: %w", num.String(), err)
+		}
+		_, err := io.WriteString(w, num.String())
+		return err
+	}
+	if b, isBool := v.(bool); isBool {
+		if b {
+			_, err := io.WriteString(w, "true")
+			return err
+		}
+		_, err := io.WriteString(w, "false")
+		return err
+	}
+	if v == nil {
+		_, err := io.WriteString(w, "null")
+		return err
+	}
+	return fmt.Errorf("jsonTo: unsupported value of type %T", v)
+}
+
+func (sjyb SmartJsonYamlBase) jsonMapTo(w io.Writer, m map[string]interface{}, indent string, prettyOutput bool) error {
+	if prettyOutput {
+		if _, err := io.WriteString(w, "{\n"+indent+"  "); err != nil {
+			return err
+		}
+	} else if _, err := io.WriteString(w, "{"); err != nil {
+		return err
+	}
+
+	c := 0
+	for _, key := range sjyb.mapKeyOrder(m) {
+		sep := ""
+		if c > 0 {
+			if prettyOutput {
+				sep = ",\n  " + indent
+			} else {
+				sep = ","
+			}
+		}
+		if _, err := io.WriteString(w, sep+"\""+jsonStringToOutput(key)+"\":"); err != nil {
+			return err
+		}
+		if err := sjyb.jsonNodeTo(w, m[key], indent+"  ", prettyOutput); err != nil {
+			return err
+		}
+		c++
+	}
+
+	if prettyOutput {
+		_, err := io.WriteString(w, "\n"+indent+"}")
+		return err
+	}
+	_, err := io.WriteString(w, "}")
+	return err
+}
+
+func (sjyb SmartJsonYamlBase) jsonArrayTo(w io.Writer, arr []interface{}, indent string, prettyOutput bool) error {
+	if prettyOutput {
+		if _, err := io.WriteString(w, "[\n"+indent+"  "); err != nil {
+			return err
+		}
+	} else if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	for i, item := range arr {
+		sep := ""
+		if i > 0 {
+			if prettyOutput {
+				sep = ",\n  " + indent
+			} else {
+				sep = ","
+			}
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if err := sjyb.jsonNodeTo(w, item, indent+"  ", prettyOutput); err != nil {
+			return err
+		}
+	}
+
+	if prettyOutput {
+		_, err := io.WriteString(w, "\n"+indent+"]")
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// mapKeyOrder returns the keys of m in the order the generator functions
+// should emit them: first every key listed in OutputMapKeyOrder (that is
+// actually present in m), then the rest - alphabetically when SortMapKeys
+// is set, in (randomized) map order otherwise.
+func (sjyb SmartJsonYamlBase) mapKeyOrder(m map[string]interface{}) []string {
+	order := make([]string, 0, len(m))
+	done := map[string]bool{}
+	for _, key := range sjyb.Config.OutputMapKeyOrder {
+		if _, ok := m[key]; ok && !done[key] {
+			order = append(order, key)
+			done[key] = true
+		}
+	}
+
+	rest := make([]string, 0, len(m)-len(order))
+	for key := range m {
+		if !done[key] {
+			rest = append(rest, key)
+		}
+	}
+	if sjyb.Config.SortMapKeys {
+		sort.Strings(rest)
+	}
+	return append(order, rest...)
+}
+
+func jsonTimeString(timeval time.Time) string {
+	if timeval.Hour() == 0 && timeval.Minute() == 0 && timeval.Second() == 0 && timeval.Nanosecond() == 0 {
+		return timeval.Format("2006-01-02")
+	}
+	return timeval.Format("2006-01-02 15:04:05")
+}
+
+// jsonEscapes maps the RFC 8259 short escapes for control characters that
+// have one; any other character below 0x20 is escaped as \u00XX instead.
+var jsonEscapes = map[rune]string{
+	'"':  "\\\"",
+	'\\': "\\\\",
+	'\b': "\\b",
+	'\f': "\\f",
+	'\n': "\\n",
+	'\r': "\\r",
+	'\t': "\\t",
+}
+
+func jsonStringToOutput(str string) string {
+	var b strings.Builder
+	for _, r := range str {
+		if esc, ok := jsonEscapes[r]; ok {
+			b.WriteString(esc)
+			continue
+		}
+		if r < 0x20 {
+			fmt.Fprintf(&b, "\\u%04x", r)
+			continue
+		}
+		if r == 0xFFFD {
+			b.WriteString("�")
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// YamlTo streams a YAML 1.2 representation of ParsedData to w, using block
+// scalars for multi-line strings and quoting only the scalars that would
+// otherwise be ambiguous (booleans, null, numbers, dates, ...).
+func (sjyb SmartJsonYamlBase) YamlTo(w io.Writer) error {
+	if _, err := io.WriteString(w, "---\n"); err != nil {
+		return err
+	}
+	if err := sjyb.yamlNodeTo(w, sjyb.ParsedData, "", "top"); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func (sjyb SmartJsonYamlBase) yamlNodeTo(w io.Writer, v interface{}, pindent string, parent string) error {
+	if m, isMap := v.(map[string]interface{}); isMap {
+		return sjyb.yamlMapTo(w, m, pindent, parent)
+	}
+	if arr, isArray := v.([]interface{}); isArray {
+		return sjyb.yamlArrayTo(w, arr, pindent, parent)
+	}
+
+	if v == nil {
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+
+	prefix := ""
+	if parent != "array" {
+		prefix = " "
+	}
+
+	if str, isStr := v.(string); isStr {
+		_, err := io.WriteString(w, prefix+sjyb.yamlStringToOutput(str, pindent)+"\n")
+		return err
+	}
+	if intval, isInt := v.(int); isInt {
+		_, err := io.WriteString(w, prefix+strconv.Itoa(intval)+"\n")
+		return err
+	}
+	if intval, isInt64 := v.(int64); isInt64 {
+		_, err := io.WriteString(w, prefix+strconv.FormatInt(intval, 10)+"\n")
+		return err
+	}
+	if flt, isFlt := v.(float64); isFlt {
+		if sjyb.ParsedFrom == "json" && flt == math.Floor(flt) && !math.IsInf(flt, 0) {
+			_, err := io.WriteString(w, prefix+strconv.Itoa(int(flt))+"\n")
+			return err
+		}
+		_, err := io.WriteString(w, prefix+strconv.FormatFloat(flt, 'g', 10, 64)+"\n")
+		return err
+	}
+	if timeval, isTime := v.(time.Time); isTime {
+		_, err := io.WriteString(w, prefix+"\""+jsonTimeString(timeval)+"\"\n")
+		return err
+	}
+	if num, isNum := v.(json.Number); isNum {
+		_, err := io.WriteString(w, prefix+num.String()+"\n")
+		return err
+	}
+	if b, isBool := v.(bool); isBool {
+		if b {
+			_, err := io.WriteString(w, prefix+"true\n")
+			return err
+		}
+		_, err := io.WriteString(w, prefix+"false\n")
+		return err
+	}
+
+	return fmt.Errorf("yamlTo: unsupported value of type %T", v)
+}
+
+func (sjyb SmartJsonYamlBase) yamlMapTo(w io.Writer, m map[string]interface{}, pindent string, parent string) error {
+	if len(m) == 0 {
+		prefix := ""
+		if parent != "array" {
+			prefix = " "
+		}
+		_, err := io.WriteString(w, prefix+"{}\n")
+		return err
+	}
+
+	if parent == "map" {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	addindent := ""
+	if parent == "map" {
+		addindent = sjyb.Config.YamlGeneratorIndenter
+	}
+
+	c := 0
+	for _, key := range sjyb.mapKeyOrder(m) {
+		if parent != "array" || c != 0 {
+			if _, err := io.WriteString(w, pindent+addindent); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, sjyb.yamlKeyToOutput(key)+":"); err != nil {
+			return err
+		}
+		if err := sjyb.yamlNodeTo(w, m[key], pindent+addindent, "map"); err != nil {
+			return err
+		}
+		c++
+	}
+	return nil
+}
+
+func (sjyb SmartJsonYamlBase) yamlArrayTo(w io.Writer, arr []interface{}, pindent string, parent string) error {
+	if len(arr) == 0 {
+		prefix := ""
+		if parent != "array" {
+			prefix = " "
+		}
+		_, err := io.WriteString(w, prefix+"[]\n")
+		return err
+	}
+
+	if parent == "map" {
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	for _, item := range arr {
+		if _, err := io.WriteString(w, pindent+"- "); err != nil {
+			return err
+		}
+		if err := sjyb.yamlNodeTo(w, item, pindent+"  ", "array"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var yamlAmbiguousScalar = regexp.MustCompile(`(?i)^(true|false|yes|no|on|off|null|~|[-+]?[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?|[0-9]{4}-[0-9]{2}-[0-9]{2}.*)$`)
+
+// yamlStringToOutput renders str as a YAML scalar: a block literal (|) for
+// multi-line content, otherwise a plain scalar quoted only when it would
+// otherwise be ambiguous (a bool/null/number/date look-alike) or contains
+// characters the plain style cannot carry safely.
+func (sjyb SmartJsonYamlBase) yamlStringToOutput(str string, pindent string) string {
+	if strings.Contains(str, "\n") {
+		return yamlBlockLiteral(str, pindent+sjyb.Config.YamlGeneratorIndenter)
+	}
+	return sjyb.yamlPlainOrQuotedScalar(str)
+}
+
+// yamlKeyToOutput renders str as a YAML map key, quoting it with the same
+// rules yamlStringToOutput applies to values (ambiguous scalars, leading
+// "-"/space, reserved punctuation, ...) so that keys such as "container:latest",
+// "123" or "- dash" round-trip through a real YAML parser. Keys containing a
+// newline are quoted with the newline escaped rather than turned into a
+// block scalar, since a block scalar cannot appear as a map key.
+func (sjyb SmartJsonYamlBase) yamlKeyToOutput(key string) string {
+	if strings.Contains(key, "\n") {
+		escaped := strings.Replace(key, "\\", "\\\\", -1)
+		escaped = strings.Replace(escaped, "\"", "\\\"", -1)
+		escaped = strings.Replace(escaped, "\n", "\\n", -1)
+		return "\"" + escaped + "\""
+	}
+	return sjyb.yamlPlainOrQuotedScalar(key)
+}
+
+// yamlPlainOrQuotedScalar renders a single-line string as a plain YAML
+// scalar, quoting it only when left unquoted it would parse back as
+// something other than this exact string (a bool/null/number/date
+// look-alike, one starting with "-"/"?", or one containing reserved
+// punctuation).
+func (sjyb SmartJsonYamlBase) yamlPlainOrQuotedScalar(str string) string {
+	needquote := sjyb.Config.YamlAlwaysUseQuotesForString
+	if str == "" {
+		needquote = true
+	}
+	if yamlAmbiguousScalar.MatchString(str) {
+		needquote = true
+	}
+	if strings.ContainsAny(str, ":#{}[],&*!|>'\"%@`") ||
+		strings.HasPrefix(str, " ") || strings.HasSuffix(str, " ") ||
+		strings.HasPrefix(str, "-") || strings.HasPrefix(str, "?") {
+		needquote = true
+	}
+
+	if !needquote {
+		return str
+	}
+	escaped := strings.Replace(str, "\\", "\\\\", -1)
+	escaped = strings.Replace(escaped, "\"", "\\\"", -1)
+	return "\"" + escaped + "\""
+}
+
+// yamlBlockLiteral renders str as a "|" block scalar, preserving a single
+// trailing newline with "|" and stripping it entirely with "|-" when str
+// has none.
+func yamlBlockLiteral(str string, indent string) string {
+	chomp := "|"
+	body := str
+	if strings.HasSuffix(body, "\n") {
+		body = strings.TrimSuffix(body, "\n")
+	} else {
+		chomp = "|-"
+	}
+	lines := strings.Split(body, "\n")
+	var b strings.Builder
+	b.WriteString(chomp + "\n")
+	for _, line := range lines {
+		b.WriteString(indent + line + "\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,56 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestYamlMapKeysAreQuotedWhenAmbiguous(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"a:b":    "v1",
+		"- dash": "v2",
+		"123":    "v3",
+		"yes":    "v4",
+	}}
+	sjyb.Config.InitConfig()
+
+	out := sjyb.Yaml()
+	for _, want := range []string{`"a:b":`, `"- dash":`, `"123":`, `"yes":`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected yaml output to contain quoted key %s, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestJsonToHandlesJsonNumber(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"big": json.Number("123456789012345678901234567890"),
+	}}
+	sjyb.Config.InitConfig()
+
+	var b strings.Builder
+	if err := sjyb.JsonTo(&b); err != nil {
+		t.Fatalf("JsonTo should encode json.Number, got error: %v", err)
+	}
+	if !strings.Contains(b.String(), "123456789012345678901234567890") {
+		t.Errorf("expected json.Number to be emitted verbatim, got: %s", b.String())
+	}
+}
+
+func TestYamlHandlesJsonNumber(t *testing.T) {
+	sjyb := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"big": json.Number("42"),
+	}}
+	sjyb.Config.InitConfig()
+
+	out := sjyb.Yaml()
+	if !strings.Contains(out, "big: 42") {
+		t.Errorf("expected yaml output to contain 'big: 42', got:\n%s", out)
+	}
+}
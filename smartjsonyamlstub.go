@@ -8,8 +8,6 @@
 package smartjsonyamlstub
 
 import (
-	"fmt"
-	"math"
 	"regexp"
 	"strconv"
 	"strings"
@@ -32,6 +30,10 @@ type SmartJsonYamlConfig struct {
 	// the Yaml and Json generator functions prefers this string order in map type nodes.
 	// This is a workaround to get rid of side effects of randomized go maps, which is used by parsers.
 	OutputMapKeyOrder []string
+	// If SortMapKeys is true the Yaml and Json generator functions sort alphabetically
+	// every map key that is not already placed by OutputMapKeyOrder, giving deterministic
+	// output for documents generated from (unordered) go maps. The default is false.
+	SortMapKeys bool
 }
 
 // SmartJsonYamlBase is the base structure of SmartJSON and SmartYAML
@@ -51,277 +53,29 @@ func (conf *SmartJsonYamlConfig) InitConfig() {
 	conf.YamlGeneratorIndenter = "  "
 	conf.YamlAlwaysUseQuotesForString = false
 	conf.OutputMapKeyOrder = []string{}
+	conf.SortMapKeys = false
 }
 
 // Yaml generates a yaml output
 func (sjyb SmartJsonYamlBase) Yaml() (out string) {
-	return sjyb.yamlNodeToString(sjyb.ParsedData, "", "top") + "\n"
+	var b strings.Builder
+	_ = sjyb.YamlTo(&b)
+	return b.String()
 }
 
 // JsonIndented generates an indented JSON
 func (sjyb SmartJsonYamlBase) JsonIndented() (out string) {
-	return sjyb.jsonNodeToString(sjyb.ParsedData, "", true) + "\n"
+	var b strings.Builder
+	_ = sjyb.jsonTo(&b, true)
+	b.WriteString("\n")
+	return b.String()
 }
 
 // JsonIndented generates an compacted JSON
 func (sjyb SmartJsonYamlBase) JsonCompacted() (out string) {
-	return sjyb.jsonNodeToString(sjyb.ParsedData, "", false)
-}
-
-func (sjyb SmartJsonYamlBase) jsonNodeToString(v interface{}, indent string, prettyOutput bool) (out string) {
-	out = ""
-	if m, isMap := v.(map[string]interface{}); isMap {
-		if prettyOutput {
-			out += "{\n" + indent + "  "
-		} else {
-			out += "{"
-		}
-		c := 0
-
-		done := []string{}
-		for _, orderedKey := range sjyb.Config.OutputMapKeyOrder {
-			if _, ok := m[orderedKey]; ok {
-				sep := ""
-				if c > 0 {
-					if prettyOutput {
-						sep = ",\n  " + indent
-					} else {
-						sep = ","
-					}
-				}
-				out += sep + "\"" + n + "\":" + sjyb.jsonNodeToString(v, indent+"  ", prettyOutput)
-				done = append(done, orderedKey)
-				c++
-			}
-		}
-
-		for n, v := range m {
-			if contains(done, n) {
-				continue
-			}
-			sep := ""
-			if c > 0 {
-				if prettyOutput {
-					sep = ",\n  " + indent
-				} else {
-					sep = ","
-				}
-			}
-			out += sep + "\"" + n + "\":" + sjyb.jsonNodeToString(v, indent+"  ", prettyOutput)
-			c++
-		}
-		if prettyOutput {
-			out += "\n" + indent + "}"
-		} else {
-			out += "}"
-		}
-		return out
-	}
-	if arr, isArray := v.([]interface{}); isArray {
-		if prettyOutput {
-			out += "[\n" + indent + "  "
-		} else {
-			out += "["
-		}
-		l := len(arr)
-		for i := 0; i < l; i++ {
-			sep := ""
-			if i > 0 {
-				if prettyOutput {
-					sep = ",\n  " + indent
-				} else {
-					sep = ","
-				}
-			}
-			out += sep + sjyb.jsonNodeToString(arr[i], indent+"  ", prettyOutput)
-		}
-		if prettyOutput {
-			out += "\n" + indent + "]"
-		} else {
-			out += "]"
-		}
-		return out
-	}
-	if str, isStr := v.(string); isStr {
-		out += "\"" + sjyb.jsonStringToOutput(str) + "\""
-		return out
-	}
-	if intval, isInt := v.(int); isInt {
-		out += fmt.Sprintf("%d", intval)
-		return out
-	}
-	if flt, isFlt := v.(float64); isFlt {
-		out += strconv.FormatFloat(flt, 'g', 10, 64)
-		return out
-	}
-	if timeval, isTime := v.(time.Time); isTime {
-		if timeval.Hour() == 0 && timeval.Minute() == 0 && timeval.Second() == 0 && timeval.Nanosecond() == 0 {
-			out += "\"" + fmt.Sprintf("%s", timeval.Format("2006-01-02")) + "\""
-		} else {
-			out += "\"" + fmt.Sprintf("%s", timeval.Format("2006-01-02 15:04:05")) + "\""
-		}
-		return out
-	}
-	if b, isBool := v.(bool); isBool {
-		if b {
-			out += "true"
-		} else {
-			out += "false"
-		}
-		return out
-	}
-	if v == nil {
-		out += "null"
-		return out
-	}
-	return ""
-}
-
-func (sjyb SmartJsonYamlBase) jsonStringToOutput(str string) string {
-	str = strings.Replace(str, "\"", "\\\"", -1)
-	return str
-}
-
-func (sjyb SmartJsonYamlBase) yamlNodeToString(v interface{}, pindent string, parent string) (out string) {
-	out = ""
-	if parent == "top" {
-		out += "---\n"
-	}
-	if m, isMap := v.(map[string]interface{}); isMap {
-		if parent == "map" {
-			out += "\n"
-		}
-		addindent := ""
-		if parent == "map" {
-			addindent = sjyb.Config.YamlGeneratorIndenter
-		}
-		c := 0
-
-		done := []string{}
-		for _, orderedKey := range sjyb.Config.OutputMapKeyOrder {
-			if _, ok := m[orderedKey]; ok {
-				if parent != "array" || c != 0 {
-					out += pindent + addindent
-				}
-				out += orderedKey + ":" + sjyb.yamlNodeToString(m[orderedKey], pindent+addindent, "map")
-				done = append(done, orderedKey)
-				c++
-			}
-		}
-
-		for n, v := range m {
-			if contains(done, n) {
-				continue
-			}
-			if parent != "array" || c != 0 {
-				out += pindent + addindent
-			}
-			out += n + ":" + sjyb.yamlNodeToString(v, pindent+addindent, "map")
-			c++
-		}
-		return out
-	}
-	if arr, isArray := v.([]interface{}); isArray {
-		if parent == "map" {
-			out += "\n"
-		}
-		l := len(arr)
-		for i := 0; i < l; i++ {
-			out += pindent
-			out += "- " + sjyb.yamlNodeToString(arr[i], pindent+"  ", "array")
-		}
-		return out
-	}
-
-	if v == nil {
-		out += "\n"
-		return out
-	}
-
-	if parent != "array" {
-		out += " "
-	}
-
-	if str, isStr := v.(string); isStr {
-		out += sjyb.yamlStringToOutput(str) + "\n"
-		return out
-	}
-	if intval, isInt := v.(int); isInt {
-		out += fmt.Sprintf("%d", intval) + "\n"
-		return out
-	}
-	if flt, isFlt := v.(float64); isFlt {
-		if sjyb.ParsedFrom == "json" && flt == math.Floor(flt) {
-			out += fmt.Sprintf("%d", int(flt)) + "\n"
-			return out
-		}
-		out += strconv.FormatFloat(flt, 'g', 10, 64) + "\n"
-		return out
-	}
-	if timeval, isTime := v.(time.Time); isTime {
-		if timeval.Hour() == 0 && timeval.Minute() == 0 && timeval.Second() == 0 && timeval.Nanosecond() == 0 {
-			out += "\"" + fmt.Sprintf("%s", timeval.Format("2006-01-02")) + "\"\n"
-		} else {
-			out += "\"" + fmt.Sprintf("%s", timeval.Format("2006-01-02 15:04:05")) + "\"\n"
-		}
-		return out
-	}
-	if b, isB := v.(bool); isB {
-		if b {
-			out += "true\n"
-		} else {
-			out += "false\n"
-		}
-		return out
-	}
-
-	return ""
-}
-
-func (sjyb SmartJsonYamlBase) yamlStringToOutput(str string) string {
-	needquote := false
-	if strings.Contains(str, "\"") ||
-		strings.Contains(str, "\\") ||
-		strings.Contains(str, ":") ||
-		strings.Contains(str, "@") ||
-		strings.Contains(str, ",") ||
-		strings.Contains(str, "&") ||
-		strings.Contains(str, "*") ||
-		strings.Contains(str, "#") ||
-		strings.Contains(str, "?") ||
-		strings.Contains(str, "-") ||
-		strings.Contains(str, "!") ||
-		strings.Contains(str, "%") ||
-		strings.Contains(str, "<") ||
-		strings.Contains(str, ">") ||
-		strings.Contains(str, "[:") ||
-		strings.Contains(str, "]") ||
-		strings.Contains(str, "{") ||
-		strings.Contains(str, "}") {
-		needquote = true
-	}
-
-	if str == "Yes" || str == "No" {
-		needquote = true
-	}
-
-	foundNonNumeric := false
-	for _, ch := range str {
-		if (ch < '0' || ch > '9') && ch != '.' {
-			foundNonNumeric = true
-			break
-		}
-	}
-	if !foundNonNumeric {
-		needquote = true
-	}
-
-	str = strings.Replace(str, "\"", "\\\"", -1)
-
-	if sjyb.Config.YamlAlwaysUseQuotesForString || needquote {
-		return "\"" + str + "\""
-	}
-	return str
+	var b strings.Builder
+	_ = sjyb.jsonTo(&b, false)
+	return b.String()
 }
 
 func (sjyb SmartJsonYamlBase) pathEvalNode(last interface{}) (interface{}, string) {
@@ -360,14 +114,19 @@ func pathPreprocess(path string) string {
 		jp = true
 	}
 
-	if len(p) > 2 && p[0:2] == "$." {
+	// "$.." (root followed directly by recursive descent) must only lose
+	// its "$", or the rewrite below would be left with just one of the two
+	// dots that mark recursive descent.
+	if strings.HasPrefix(p, "$..") {
+		p = p[1:]
+		jp = true
+	} else if len(p) > 2 && p[0:2] == "$." {
 		p = p[2:]
 		jp = true
 	}
 
 	if jp {
-		p = strings.Replace(p, ".", "/", -1)
-		p = strings.Replace(p, "[", "/[", -1)
+		p = jsonPathDotsToSlashes(p)
 	}
 
 	p = strings.Replace(p, "//", "/", -1)
@@ -378,6 +137,46 @@ func pathPreprocess(path string) string {
 	return p
 }
 
+// jsonPathDotsToSlashes rewrites the dot-separated child access notation of
+// a (prefix-stripped) JSONPath expression into this module's own
+// slash-separated notation, e.g. "a.b[0]" becomes "a/b/[0]". A run of two
+// dots is recursive descent and becomes "../" (this module's own marker for
+// it) rather than being split into two empty segments. Anything inside a
+// "[...]" segment (slice bounds, union indexes, filter expressions such as
+// "@.field") is copied through unchanged, since it already uses this
+// module's own notation.
+func jsonPathDotsToSlashes(p string) string {
+	out := make([]byte, 0, len(p)+4)
+	depth := 0
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '[':
+			if len(out) > 0 && out[len(out)-1] != '/' {
+				out = append(out, '/')
+			}
+			depth++
+			out = append(out, c)
+		case c == ']':
+			depth--
+			out = append(out, c)
+		case c == '.' && depth == 0:
+			if i+1 < len(p) && p[i+1] == '.' {
+				if len(out) > 0 && out[len(out)-1] != '/' {
+					out = append(out, '/')
+				}
+				out = append(out, '.', '.', '/')
+				i++
+			} else {
+				out = append(out, '/')
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
 // NodeExists return true or false depends on the json/yaml node specified by the path is exists or not
 func (sjyb SmartJsonYamlBase) NodeExists(path string) bool {
 	_, t := sjyb.GetNodeByPath(path)
@@ -389,8 +188,20 @@ func (sjyb SmartJsonYamlBase) NodeExists(path string) bool {
 
 // GetNodeByPath search the json/yaml node specified by the path and
 // returns the value as interface{} and the type as string
+// When path contains a JSONPath construct only QueryNodesByPath understands
+// (wildcards, recursive descent, slices, unions or filter expressions) the
+// first matching node is returned, preserving this single-value API.
 func (sjyb SmartJsonYamlBase) GetNodeByPath(path string) (interface{}, string) {
-	parts := strings.Split(pathPreprocess(path), "/")
+	preprocessed := pathPreprocess(path)
+	if isAdvancedPath(preprocessed) {
+		nodes, _ := sjyb.QueryNodesByPath(path)
+		if len(nodes) == 0 {
+			return nil, sjyb.Config.NotFoundOrInvalidNotation
+		}
+		return sjyb.pathEvalNode(nodes[0])
+	}
+
+	parts := strings.Split(preprocessed, "/")
 	n := sjyb.ParsedData
 	for i := 0; i < len(parts); i++ {
 		if map_node, isMap_node := n.(map[string]interface{}); isMap_node {
@@ -608,12 +419,3 @@ func (sjyb SmartJsonYamlBase) GetCountDescendantsByPath(path string) int {
 	}
 	return 0
 }
-
-func contains(elems []string, v string) bool {
-	for _, s := range elems {
-		if v == s {
-			return true
-		}
-	}
-	return false
-}
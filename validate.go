@@ -0,0 +1,388 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// ValidationError describes one JSON Schema keyword that ParsedData failed
+// to satisfy.
+type ValidationError struct {
+	// InstancePath is the location of the offending node, in this module's
+	// own "/a/[0]/b" path notation.
+	InstancePath string
+	// SchemaPath is the location of the failing keyword inside the schema,
+	// written as "/"-separated schema keys with array positions as plain
+	// numbers (e.g. "/properties/tags/items/type" or "/allOf/0/minimum").
+	SchemaPath string
+	// Keyword is the JSON Schema keyword that failed (e.g. "type", "enum")
+	Keyword string
+	// Message is a human readable description of the failure
+	Message string
+}
+
+func (ve ValidationError) String() string {
+	return fmt.Sprintf("%s: %s (keyword %q at %s)", ve.InstancePath, ve.Message, ve.Keyword, ve.SchemaPath)
+}
+
+// Validate validates ParsedData against schema, a JSON Schema (Draft
+// 2020-12) document supplied as another SmartJsonYamlBase. It returns every
+// validation failure found; an empty slice means the document is valid.
+func (sjyb SmartJsonYamlBase) Validate(schema SmartJsonYamlBase) []ValidationError {
+	v := &schemaValidator{root: schema.ParsedData}
+	return v.validateAt(sjyb.ParsedData, schema.ParsedData, "", "")
+}
+
+type schemaValidator struct {
+	root interface{}
+}
+
+func (v *schemaValidator) validateAt(instance interface{}, schema interface{}, instancePath string, schemaPath string) []ValidationError {
+	schemaMap, isMap := schema.(map[string]interface{})
+	if !isMap {
+		// a bare boolean schema: true accepts everything, false rejects everything
+		if b, isBool := schema.(bool); isBool && !b {
+			return []ValidationError{v.fail(instancePath, schemaPath, "false", "schema is `false`, no instance is valid")}
+		}
+		return nil
+	}
+
+	errs := []ValidationError{}
+
+	if ref, ok := schemaMap["$ref"].(string); ok {
+		resolved, err := v.resolveRef(ref)
+		if err != nil {
+			return []ValidationError{v.fail(instancePath, schemaPath+"/$ref", "$ref", err.Error())}
+		}
+		return v.validateAt(instance, resolved, instancePath, schemaPath+"/$ref")
+	}
+
+	if t, ok := schemaMap["type"]; ok {
+		errs = append(errs, v.checkType(instance, t, instancePath, schemaPath+"/type")...)
+	}
+	if enum, ok := schemaMap["enum"].([]interface{}); ok {
+		errs = append(errs, v.checkEnum(instance, enum, instancePath, schemaPath+"/enum")...)
+	}
+	if cst, ok := schemaMap["const"]; ok {
+		if !filterEquals(instance, cst) {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/const", "const", "value does not equal the required constant"))
+		}
+	}
+
+	errs = append(errs, v.checkNumeric(instance, schemaMap, instancePath, schemaPath)...)
+	errs = append(errs, v.checkString(instance, schemaMap, instancePath, schemaPath)...)
+	errs = append(errs, v.checkArray(instance, schemaMap, instancePath, schemaPath)...)
+	errs = append(errs, v.checkObject(instance, schemaMap, instancePath, schemaPath)...)
+	errs = append(errs, v.checkCombinators(instance, schemaMap, instancePath, schemaPath)...)
+
+	return errs
+}
+
+func (v *schemaValidator) fail(instancePath string, schemaPath string, keyword string, message string) ValidationError {
+	return ValidationError{InstancePath: normalizeInstancePath(instancePath), SchemaPath: schemaPath, Keyword: keyword, Message: message}
+}
+
+func normalizeInstancePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func (v *schemaValidator) resolveRef(ref string) (interface{}, error) {
+	if len(ref) < 2 || ref[0:2] != "#/" {
+		return nil, fmt.Errorf("only local #/... refs are supported, got %q", ref)
+	}
+	tmp := SmartJsonYamlBase{ParsedData: v.root}
+	tmp.Config.InitConfig()
+	node, typ := tmp.GetNodeByPath(ref[1:])
+	if typ == tmp.Config.NotFoundOrInvalidNotation {
+		return nil, fmt.Errorf("$ref %q does not resolve", ref)
+	}
+	return node, nil
+}
+
+func jsonSchemaTypeOf(instance interface{}) string {
+	switch n := instance.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case int:
+		return "integer"
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	case nil:
+		return "null"
+	}
+	return ""
+}
+
+func (v *schemaValidator) checkType(instance interface{}, t interface{}, instancePath string, schemaPath string) []ValidationError {
+	actual := jsonSchemaTypeOf(instance)
+	var allowed []string
+	switch tv := t.(type) {
+	case string:
+		allowed = []string{tv}
+	case []interface{}:
+		for _, x := range tv {
+			if s, ok := x.(string); ok {
+				allowed = append(allowed, s)
+			}
+		}
+	default:
+		return nil
+	}
+	for _, a := range allowed {
+		if a == actual {
+			return nil
+		}
+		if a == "number" && actual == "integer" {
+			return nil
+		}
+	}
+	return []ValidationError{v.fail(instancePath, schemaPath, "type", fmt.Sprintf("expected type %v, got %q", allowed, actual))}
+}
+
+func (v *schemaValidator) checkEnum(instance interface{}, enum []interface{}, instancePath string, schemaPath string) []ValidationError {
+	for _, e := range enum {
+		if filterEquals(instance, e) {
+			return nil
+		}
+	}
+	return []ValidationError{v.fail(instancePath, schemaPath, "enum", "value is not one of the allowed enum values")}
+}
+
+func (v *schemaValidator) checkNumeric(instance interface{}, schemaMap map[string]interface{}, instancePath string, schemaPath string) []ValidationError {
+	num, isNum := toFilterFloat(instance)
+	if !isNum {
+		return nil
+	}
+	errs := []ValidationError{}
+	if min, ok := toFilterFloat(schemaMap["minimum"]); ok && num < min {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/minimum", "minimum", fmt.Sprintf("%v is less than minimum %v", num, min)))
+	}
+	if max, ok := toFilterFloat(schemaMap["maximum"]); ok && num > max {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/maximum", "maximum", fmt.Sprintf("%v is greater than maximum %v", num, max)))
+	}
+	if min, ok := toFilterFloat(schemaMap["exclusiveMinimum"]); ok && num <= min {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/exclusiveMinimum", "exclusiveMinimum", fmt.Sprintf("%v is not greater than exclusiveMinimum %v", num, min)))
+	}
+	if max, ok := toFilterFloat(schemaMap["exclusiveMaximum"]); ok && num >= max {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/exclusiveMaximum", "exclusiveMaximum", fmt.Sprintf("%v is not less than exclusiveMaximum %v", num, max)))
+	}
+	return errs
+}
+
+func (v *schemaValidator) checkString(instance interface{}, schemaMap map[string]interface{}, instancePath string, schemaPath string) []ValidationError {
+	str, isStr := instance.(string)
+	if !isStr {
+		return nil
+	}
+	errs := []ValidationError{}
+	runeLen := len([]rune(str))
+	if min, ok := toFilterFloat(schemaMap["minLength"]); ok && runeLen < int(min) {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/minLength", "minLength", fmt.Sprintf("length %d is less than minLength %v", runeLen, min)))
+	}
+	if max, ok := toFilterFloat(schemaMap["maxLength"]); ok && runeLen > int(max) {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/maxLength", "maxLength", fmt.Sprintf("length %d is greater than maxLength %v", runeLen, max)))
+	}
+	if pattern, ok := schemaMap["pattern"].(string); ok {
+		if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(str) {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/pattern", "pattern", fmt.Sprintf("value does not match pattern %q", pattern)))
+		}
+	}
+	if format, ok := schemaMap["format"].(string); ok {
+		if msg := checkStringFormat(str, format); msg != "" {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/format", "format", msg))
+		}
+	}
+	return errs
+}
+
+var uuidRe = regexp.MustCompile(`(?i)^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+func checkStringFormat(str string, format string) string {
+	switch format {
+	case "date":
+		if _, err := time.Parse("2006-01-02", str); err != nil {
+			return fmt.Sprintf("%q is not a valid date", str)
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return fmt.Sprintf("%q is not a valid date-time", str)
+		}
+	case "email":
+		if _, err := mail.ParseAddress(str); err != nil {
+			return fmt.Sprintf("%q is not a valid email", str)
+		}
+	case "uri":
+		u, err := url.Parse(str)
+		if err != nil || !u.IsAbs() {
+			return fmt.Sprintf("%q is not a valid uri", str)
+		}
+	case "uuid":
+		if !uuidRe.MatchString(str) {
+			return fmt.Sprintf("%q is not a valid uuid", str)
+		}
+	case "ipv4":
+		ip := net.ParseIP(str)
+		if ip == nil || ip.To4() == nil {
+			return fmt.Sprintf("%q is not a valid ipv4 address", str)
+		}
+	case "ipv6":
+		ip := net.ParseIP(str)
+		if ip == nil || ip.To4() != nil {
+			return fmt.Sprintf("%q is not a valid ipv6 address", str)
+		}
+	}
+	return ""
+}
+
+func (v *schemaValidator) checkArray(instance interface{}, schemaMap map[string]interface{}, instancePath string, schemaPath string) []ValidationError {
+	arr, isArr := instance.([]interface{})
+	if !isArr {
+		return nil
+	}
+	errs := []ValidationError{}
+	if min, ok := toFilterFloat(schemaMap["minItems"]); ok && len(arr) < int(min) {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/minItems", "minItems", fmt.Sprintf("has %d items, less than minItems %v", len(arr), min)))
+	}
+	if max, ok := toFilterFloat(schemaMap["maxItems"]); ok && len(arr) > int(max) {
+		errs = append(errs, v.fail(instancePath, schemaPath+"/maxItems", "maxItems", fmt.Sprintf("has %d items, more than maxItems %v", len(arr), max)))
+	}
+
+	prefixItems, _ := schemaMap["prefixItems"].([]interface{})
+	for i, item := range arr {
+		itemPath := joinPath(instancePath, indexSeg(i))
+		if i < len(prefixItems) {
+			errs = append(errs, v.validateAt(item, prefixItems[i], itemPath, fmt.Sprintf("%s/prefixItems/%d", schemaPath, i))...)
+			continue
+		}
+		if items, ok := schemaMap["items"]; ok {
+			errs = append(errs, v.validateAt(item, items, itemPath, schemaPath+"/items")...)
+		}
+	}
+	return errs
+}
+
+func (v *schemaValidator) checkObject(instance interface{}, schemaMap map[string]interface{}, instancePath string, schemaPath string) []ValidationError {
+	m, isMap := instance.(map[string]interface{})
+	if !isMap {
+		return nil
+	}
+	errs := []ValidationError{}
+
+	if required, ok := schemaMap["required"].([]interface{}); ok {
+		for _, r := range required {
+			key, isStr := r.(string)
+			if !isStr {
+				continue
+			}
+			if _, present := m[key]; !present {
+				errs = append(errs, v.fail(instancePath, schemaPath+"/required", "required", fmt.Sprintf("missing required property %q", key)))
+			}
+		}
+	}
+
+	properties, _ := schemaMap["properties"].(map[string]interface{})
+	patternProperties, _ := schemaMap["patternProperties"].(map[string]interface{})
+	matched := map[string]bool{}
+
+	for key, propSchema := range properties {
+		if val, present := m[key]; present {
+			matched[key] = true
+			errs = append(errs, v.validateAt(val, propSchema, joinPath(instancePath, key), schemaPath+"/properties/"+key)...)
+		}
+	}
+
+	for pattern, propSchema := range patternProperties {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			continue
+		}
+		for key, val := range m {
+			if re.MatchString(key) {
+				matched[key] = true
+				errs = append(errs, v.validateAt(val, propSchema, joinPath(instancePath, key), schemaPath+"/patternProperties/"+pattern)...)
+			}
+		}
+	}
+
+	if additional, ok := schemaMap["additionalProperties"]; ok {
+		if allowed, isBool := additional.(bool); isBool && !allowed {
+			for key := range m {
+				if !matched[key] {
+					errs = append(errs, v.fail(joinPath(instancePath, key), schemaPath+"/additionalProperties", "additionalProperties", fmt.Sprintf("property %q is not allowed", key)))
+				}
+			}
+		} else if _, isMap := additional.(map[string]interface{}); isMap {
+			for key, val := range m {
+				if !matched[key] {
+					errs = append(errs, v.validateAt(val, additional, joinPath(instancePath, key), schemaPath+"/additionalProperties")...)
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func (v *schemaValidator) checkCombinators(instance interface{}, schemaMap map[string]interface{}, instancePath string, schemaPath string) []ValidationError {
+	errs := []ValidationError{}
+
+	if allOf, ok := schemaMap["allOf"].([]interface{}); ok {
+		for i, sub := range allOf {
+			errs = append(errs, v.validateAt(instance, sub, instancePath, fmt.Sprintf("%s/allOf/%d", schemaPath, i))...)
+		}
+	}
+
+	if anyOf, ok := schemaMap["anyOf"].([]interface{}); ok {
+		ok := false
+		for _, sub := range anyOf {
+			if len(v.validateAt(instance, sub, instancePath, schemaPath)) == 0 {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/anyOf", "anyOf", "instance does not match any schema in anyOf"))
+		}
+	}
+
+	if oneOf, ok := schemaMap["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if len(v.validateAt(instance, sub, instancePath, schemaPath)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/oneOf", "oneOf", fmt.Sprintf("instance matches %d schemas in oneOf, expected exactly 1", matches)))
+		}
+	}
+
+	if not, ok := schemaMap["not"]; ok {
+		if len(v.validateAt(instance, not, instancePath, schemaPath+"/not")) == 0 {
+			errs = append(errs, v.fail(instancePath, schemaPath+"/not", "not", "instance matches the schema under \"not\""))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,49 @@
+/*  Common codes to Smart JSON-YAML functions
+    (C) 2021-2022 Péter Deák (hyper80@gmail.com)
+    License: Apache 2.0
+*/
+
+package smartjsonyamlstub
+
+import "testing"
+
+func TestValidateEnumWithObjects(t *testing.T) {
+	schema := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"enum": []interface{}{
+			map[string]interface{}{"a": 1},
+			map[string]interface{}{"a": 2},
+		},
+	}}
+	schema.Config.InitConfig()
+
+	match := SmartJsonYamlBase{ParsedData: map[string]interface{}{"a": 1}}
+	match.Config.InitConfig()
+	if errs := match.Validate(schema); len(errs) != 0 {
+		t.Fatalf("expected matching object to satisfy enum, got %v", errs)
+	}
+
+	noMatch := SmartJsonYamlBase{ParsedData: map[string]interface{}{"a": 3}}
+	noMatch.Config.InitConfig()
+	if errs := noMatch.Validate(schema); len(errs) == 0 {
+		t.Fatalf("expected non-matching object to fail enum")
+	}
+}
+
+func TestValidateConstWithArray(t *testing.T) {
+	schema := SmartJsonYamlBase{ParsedData: map[string]interface{}{
+		"const": []interface{}{1, 2, 3},
+	}}
+	schema.Config.InitConfig()
+
+	match := SmartJsonYamlBase{ParsedData: []interface{}{1, 2, 3}}
+	match.Config.InitConfig()
+	if errs := match.Validate(schema); len(errs) != 0 {
+		t.Fatalf("expected matching array to satisfy const, got %v", errs)
+	}
+
+	noMatch := SmartJsonYamlBase{ParsedData: []interface{}{1, 2, 4}}
+	noMatch.Config.InitConfig()
+	if errs := noMatch.Validate(schema); len(errs) == 0 {
+		t.Fatalf("expected non-matching array to fail const")
+	}
+}